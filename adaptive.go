@@ -0,0 +1,186 @@
+package slide
+
+import (
+	"math"
+
+	"github.com/paulmach/go.geo"
+)
+
+// Parameters of the adaptive re-parameterization, see Slide.AdaptiveInterval.
+// Spacings are relative to the ResampleInterval.
+const (
+	adaptiveMaxSpacing      = 1.5         // segments longer than this are split, unless straight
+	adaptiveMinSpacing      = 0.5         // vertices closer than this to both neighbours are removed
+	adaptiveStraightSpacing = 4.5         // straight stretches are thinned out to segments up to this long
+	adaptiveBendSpacing     = 0.5         // at bends segments longer than this are split
+	adaptiveBendAngle       = math.Pi / 6 // turning angle considered a sharp bend
+	adaptiveStraightAngle   = math.Pi / 36
+)
+
+// A Remapper is an Optimizer that can keep its per vertex state when vertices are inserted
+// or removed during refinement, see Slide.AdaptiveInterval. Optimizers that are not
+// Remappers are recreated and lose their state.
+type Remapper interface {
+	// Remap is called with the location of every new vertex in terms of the old indexes.
+	// For example, 2.5 is a vertex inserted halfway between old vertices 2 and 3.
+	Remap(sources []float64)
+}
+
+// reparameterize inserts vertices where the path is sparse or bends sharply and removes
+// them where they are redundant, such as on straight stretches. The endpoints are never changed.
+// Spacing is the ResampleInterval converted to projected units at every vertex.
+func (s *Slide) reparameterize(state *pathState, projection Projection) {
+	path := state.Path
+
+	// first remove, then insert so the inserted vertices are not removed right away.
+	sources := make([]float64, 0, path.Length())
+	sources = append(sources, 0)
+
+	removed := false
+	for i := 1; i < path.Length()-1; i++ {
+		if removed {
+			// never remove consecutive vertices
+			removed = false
+			sources = append(sources, float64(i))
+			continue
+		}
+
+		prev := path.GetAt(i - 1)
+		next := path.GetAt(i + 1)
+		span := prev.DistanceFrom(next)
+		spacing := s.ResampleInterval * projection.ScaleFactor(path.GetAt(i))
+
+		crowded := prev.DistanceFrom(path.GetAt(i)) < adaptiveMinSpacing*spacing &&
+			next.DistanceFrom(path.GetAt(i)) < adaptiveMinSpacing*spacing
+
+		// the neighbours must also be straight so the new, longer, segment is not split again below.
+		straight := span < adaptiveStraightSpacing*spacing &&
+			turningAngle(path, i-1) < adaptiveStraightAngle &&
+			turningAngle(path, i) < adaptiveStraightAngle &&
+			turningAngle(path, i+1) < adaptiveStraightAngle
+
+		if crowded || straight {
+			removed = true
+			continue
+		}
+
+		sources = append(sources, float64(i))
+	}
+	sources = append(sources, float64(path.Length()-1))
+
+	// now insert midpoints on long segments, on segments that are not straight and
+	// on segments next to sharp bends. Angles are of the vertices before removal.
+	inserted := make([]float64, 0, 2*len(sources))
+	for k := 0; k < len(sources)-1; k++ {
+		inserted = append(inserted, sources[k])
+
+		a := pointAt(path, sources[k])
+		b := pointAt(path, sources[k+1])
+		length := a.DistanceFrom(b)
+		spacing := s.ResampleInterval * projection.ScaleFactor(a)
+
+		angle := math.Max(turningAngle(path, int(sources[k])), turningAngle(path, int(sources[k+1])))
+		curved := angle >= adaptiveStraightAngle
+		bend := angle > adaptiveBendAngle
+
+		if length > adaptiveStraightSpacing*spacing ||
+			(curved && length > adaptiveMaxSpacing*spacing) ||
+			(bend && length > adaptiveBendSpacing*spacing) {
+			inserted = append(inserted, (sources[k]+sources[k+1])/2)
+		}
+	}
+	inserted = append(inserted, sources[len(sources)-1])
+
+	if len(inserted) == path.Length() && len(sources) == path.Length() {
+		return // nothing changed
+	}
+
+	newPath := geo.NewPathPreallocate(0, len(inserted))
+	for _, source := range inserted {
+		newPath.Push(pointAt(path, source))
+	}
+
+	state.Path = newPath
+	state.Forces = make([]geo.Point, newPath.Length())
+	state.Last = nil // energies are of the old vertices
+
+	if remapper, ok := state.Optimizer.(Remapper); ok {
+		remapper.Remap(inserted)
+	} else {
+		state.Optimizer = s.newOptimizer()
+	}
+}
+
+// pointAt returns the point at the, possibly fractional, index along the path.
+// The fraction is linearly interpolated between the vertices, it is not based on distance.
+func pointAt(path *geo.Path, index float64) *geo.Point {
+	i := int(index)
+	t := index - float64(i)
+	if t == 0 {
+		return path.GetAt(i).Clone()
+	}
+
+	return path.GetAt(i + 1).Clone().Subtract(path.GetAt(i)).Scale(t).Add(path.GetAt(i))
+}
+
+// remapPoints returns the per vertex values at the new, possibly fractional, indexes.
+func remapPoints(points []geo.Point, sources []float64) []geo.Point {
+	if points == nil {
+		return nil
+	}
+
+	result := make([]geo.Point, len(sources))
+	for i, source := range sources {
+		j := int(source)
+		t := source - float64(j)
+
+		result[i] = points[j]
+		if t != 0 {
+			result[i].Scale(1 - t).Add(points[j+1].Clone().Scale(t))
+		}
+	}
+
+	return result
+}
+
+// turningAngle is the change in direction, in radians, at the vertex.
+// Zero for a straight line.
+func turningAngle(path *geo.Path, index int) float64 {
+	if index <= 0 || index >= path.Length()-1 {
+		return 0
+	}
+
+	in := path.GetAt(index).Clone().Subtract(path.GetAt(index - 1))
+	out := path.GetAt(index + 1).Clone().Subtract(path.GetAt(index))
+
+	lengths := math.Sqrt(in.Dot(in) * out.Dot(out))
+	if lengths == 0 {
+		return 0
+	}
+
+	return math.Acos(math.Max(-1, math.Min(1, in.Dot(out)/lengths)))
+}
+
+// Remap keeps the previous corrections with the vertices.
+func (m *momentum) Remap(sources []float64) {
+	m.corrections = remapPoints(m.corrections, sources)
+}
+
+// Remap keeps the velocities with the vertices.
+func (n *nesterov) Remap(sources []float64) {
+	n.velocity = remapPoints(n.velocity, sources)
+	n.corrections = remapPoints(n.corrections, sources)
+}
+
+// Remap keeps the running averages with the vertices.
+func (a *adam) Remap(sources []float64) {
+	a.mean = remapPoints(a.mean, sources)
+	a.variance = remapPoints(a.variance, sources)
+	a.corrections = remapPoints(a.corrections, sources)
+}
+
+// Remap clears the history, previous steps do not apply to the new vertices.
+func (l *lbfgs) Remap(sources []float64) {
+	l.s, l.y = nil, nil
+	l.previousPath, l.previousGradient = nil, nil
+}
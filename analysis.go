@@ -0,0 +1,105 @@
+package slide
+
+import (
+	"math"
+
+	"github.com/paulmach/go.geo"
+)
+
+// analyze computes the per vertex displacement, surface value and confidence
+// of the corrected geometry. All geometry is in lat/lng (EPSG:4326).
+func (s *Slide) analyze(result *Result, input []*geo.Path) {
+	result.Displacements = make([][]float64, len(result.CorrectedGeometry))
+	result.SurfaceValues = make([][]float64, len(result.CorrectedGeometry))
+	result.Confidences = make([][]float64, len(result.CorrectedGeometry))
+
+	for i, p := range result.CorrectedGeometry {
+		original := input[i].Clone().Transform(s.Projection.Project)
+		path := p.Clone().Transform(s.Projection.Project)
+
+		displacements := make([]float64, path.Length())
+		values := make([]float64, path.Length())
+		confidences := make([]float64, path.Length())
+
+		for j := 0; j < path.Length(); j++ {
+			point := path.GetAt(j)
+			scaleFactor := s.Projection.ScaleFactor(point)
+
+			displacements[j] = distanceToPath(point, original) / scaleFactor
+			values[j] = s.Surfacer.ValueAt(point)
+			confidences[j] = s.confidence(path, j, s.ResampleInterval*scaleFactor)
+		}
+
+		result.Displacements[i] = displacements
+		result.SurfaceValues[i] = values
+		result.Confidences[i] = confidences
+	}
+}
+
+// confidence is the average surface value, clamped to [0, 1], sampled every step along
+// the path from halfway to the previous vertex to halfway to the next vertex.
+// It shows if the vertex is supported by the surface data and not just a single pixel.
+func (s *Slide) confidence(path *geo.Path, index int, step float64) float64 {
+	point := path.GetAt(index)
+
+	sum := clampUnit(s.Surfacer.ValueAt(point))
+	count := 1
+
+	for _, n := range []int{index - 1, index + 1} {
+		if n < 0 || n >= path.Length() {
+			continue
+		}
+
+		half := path.GetAt(n).Clone().Subtract(point).Scale(0.5)
+		samples := int(math.Ceil(half.DistanceFrom(geo.NewPoint(0, 0)) / step))
+		for k := 1; k <= samples; k++ {
+			sample := half.Clone().Scale(float64(k) / float64(samples)).Add(point)
+			sum += clampUnit(s.Surfacer.ValueAt(sample))
+			count++
+		}
+	}
+
+	return sum / float64(count)
+}
+
+// distanceToPath returns the distance from the point to the closest segment of the path.
+func distanceToPath(point *geo.Point, path *geo.Path) float64 {
+	return point.DistanceFrom(closestOnPath(point, path))
+}
+
+// closestOnPath returns the point on the path closest to the given point.
+func closestOnPath(point *geo.Point, path *geo.Path) *geo.Point {
+	closest := path.GetAt(0).Clone()
+	if path.Length() == 1 {
+		return closest
+	}
+
+	min := math.Inf(1)
+	for i := 1; i < path.Length(); i++ {
+		c := closestOnSegment(point, path.GetAt(i-1), path.GetAt(i))
+		if d := point.SquaredDistanceFrom(c); d < min {
+			min = d
+			closest = c
+		}
+	}
+
+	return closest
+}
+
+// closestOnSegment returns the point on the line segment a-b closest to the given point.
+func closestOnSegment(point, a, b *geo.Point) *geo.Point {
+	ab := b.Clone().Subtract(a)
+	ap := point.Clone().Subtract(a)
+
+	dot := ab.Dot(ab)
+	if dot == 0 {
+		return a.Clone()
+	}
+
+	t := math.Max(0, math.Min(1, ap.Dot(ab)/dot))
+	return ab.Scale(t).Add(a)
+}
+
+func clampUnit(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
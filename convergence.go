@@ -0,0 +1,160 @@
+package slide
+
+import (
+	"math"
+	"time"
+
+	"github.com/paulmach/go.geo"
+)
+
+// A Convergence decides, after every loop, if a path is done refining.
+// See ScoreDelta, MaxMovement, RelativeEnergyChange and Budget for the
+// built in rules, they can be combined using All and Any.
+type Convergence interface {
+	Converged(state *LoopState) bool
+}
+
+// ConvergenceFunc allows a function to be used as a Convergence.
+type ConvergenceFunc func(state *LoopState) bool
+
+// Converged calls the function.
+func (f ConvergenceFunc) Converged(state *LoopState) bool {
+	return f(state)
+}
+
+// LoopState is the state of a path after a refinement loop, used to check convergence.
+// The state and paths are reused between loops so they are only valid during Converged.
+type LoopState struct {
+	Loop      int     // of the stage, so MinLoops applies to every stage of a schedule
+	PathScore float64 // average surface value of the path
+	Score     float64 // exponentially smoothed path score
+	Delta     float64 // change in the smoothed score
+
+	// MaxMovement is the largest movement, in meters, of any vertex during the loop.
+	MaxMovement float64
+
+	// Elapsed is the time since the start of the refinement, always zero in Deterministic mode.
+	Elapsed time.Duration
+
+	terms          []EnergyTerm
+	env            *Environment
+	path           *geo.Path
+	previous       *geo.Path
+	energy         float64
+	previousEnergy float64
+
+	hasEnergy, hasPreviousEnergy bool // computed
+}
+
+// Energy returns the energy of the path after the loop, the sum of the energy
+// of the terms including the tether to the original path. It is computed on first use.
+func (ls *LoopState) Energy() float64 {
+	if !ls.hasEnergy {
+		ls.energy, ls.hasEnergy = energy(ls.terms, ls.path, ls.env), true
+	}
+
+	return ls.energy
+}
+
+// PreviousEnergy returns the energy of the path before the loop. It is computed on first use.
+func (ls *LoopState) PreviousEnergy() float64 {
+	if !ls.hasPreviousEnergy {
+		ls.previousEnergy, ls.hasPreviousEnergy = energy(ls.terms, ls.previous, ls.env), true
+	}
+
+	return ls.previousEnergy
+}
+
+// ScoreDelta is the default rule, the path is converged when the change in the
+// exponentially smoothed path score is less than epsilon, after minLoops.
+// This is MinLoops and ThresholdEpsilon of the Slide.
+func ScoreDelta(minLoops int, epsilon float64) Convergence {
+	return ConvergenceFunc(func(state *LoopState) bool {
+		return state.Loop >= minLoops && state.Delta < epsilon
+	})
+}
+
+// MaxMovement is converged when no vertex moved more than the
+// given meters during the loop, after minLoops.
+func MaxMovement(minLoops int, meters float64) Convergence {
+	return ConvergenceFunc(func(state *LoopState) bool {
+		return state.Loop >= minLoops && state.MaxMovement < meters
+	})
+}
+
+// RelativeEnergyChange is converged when the change in energy relative
+// to the previous energy is less than epsilon, after minLoops.
+func RelativeEnergyChange(minLoops int, epsilon float64) Convergence {
+	return ConvergenceFunc(func(state *LoopState) bool {
+		if state.Loop < minLoops {
+			return false
+		}
+
+		previous := state.PreviousEnergy()
+		change := math.Abs(state.Energy() - previous)
+		if previous == 0 {
+			return change == 0
+		}
+
+		return change/math.Abs(previous) < epsilon
+	})
+}
+
+// Budget is converged once the refinement has run for the given wall clock duration.
+// In Deterministic mode Elapsed is always zero, so a positive duration never converges
+// and zero or less converges at the first loop, as it always does.
+func Budget(duration time.Duration) Convergence {
+	return ConvergenceFunc(func(state *LoopState) bool {
+		return state.Elapsed >= duration
+	})
+}
+
+// All is converged when all the given rules are converged.
+// Every rule is checked every loop.
+func All(rules ...Convergence) Convergence {
+	return ConvergenceFunc(func(state *LoopState) bool {
+		converged := true
+		for _, rule := range rules {
+			if !rule.Converged(state) {
+				converged = false
+			}
+		}
+
+		return converged
+	})
+}
+
+// Any is converged when at least one of the given rules is converged.
+// Every rule is checked every loop.
+func Any(rules ...Convergence) Convergence {
+	return ConvergenceFunc(func(state *LoopState) bool {
+		converged := false
+		for _, rule := range rules {
+			if rule.Converged(state) {
+				converged = true
+			}
+		}
+
+		return converged
+	})
+}
+
+// convergence returns the rule to use, defaults to ScoreDelta using MinLoops and ThresholdEpsilon.
+func (s *Slide) convergence() Convergence {
+	if s.Convergence != nil {
+		return s.Convergence
+	}
+
+	return ScoreDelta(s.MinLoops, s.ThresholdEpsilon)
+}
+
+// maxMovement returns the largest distance, in meters, between the matching vertices of the paths.
+func maxMovement(path, previous *geo.Path, projection Projection) float64 {
+	max := 0.0
+	for i := 0; i < path.Length(); i++ {
+		d := path.GetAt(i).DistanceFrom(previous.GetAt(i)) / projection.ScaleFactor(path.GetAt(i))
+		max = math.Max(max, d)
+	}
+
+	return max
+}
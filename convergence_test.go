@@ -0,0 +1,38 @@
+package slide
+
+import (
+	"testing"
+	"time"
+
+	"github.com/paulmach/go.geo"
+)
+
+func TestBudgetDeterministic(t *testing.T) {
+	input := geo.NewPath()
+	input.Push(geo.NewPoint(-122.0, 37.0))
+	input.Push(geo.NewPoint(-121.99, 37.0005))
+
+	for _, c := range []struct {
+		budget time.Duration
+		loops  int
+	}{
+		{time.Hour, 5},
+		{time.Nanosecond, 5},
+		{0, 1},
+		{-time.Second, 1},
+	} {
+		s := New([]*geo.Path{input}, benchSurfacer{})
+		s.Deterministic = true
+		s.MaxLoops = 5
+		s.Convergence = Budget(c.budget)
+
+		result, err := s.Do()
+		if err != nil {
+			t.Fatalf("budget %v: unexpected error: %v", c.budget, err)
+		}
+
+		if result.LoopsCompleted != c.loops {
+			t.Errorf("budget %v: expected %d loops, got %d", c.budget, c.loops, result.LoopsCompleted)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package slide
+
+import (
+	"github.com/paulmach/go.geo"
+)
+
+// PathEnergy is the energy of a projected path that the refinement minimizes.
+// Lower is better. It is the sum of the Energy of the terms, see Slide.Terms.
+// For the default terms it is the sum of:
+//   - the negative surface value, using SmoothValueAt if the Surfacer is a SmoothValuer,
+//   - a spring between neighbouring vertices for the distance contribution,
+//   - a bending term on the second difference for the angle contribution.
+//
+// Each is weighted by the matching scale parameter. There is no original path
+// so the tether term is not included.
+func (s *Slide) PathEnergy(path *geo.Path) float64 {
+	projected := s.withProjection(s.projection())
+	return energy(s.terms(), path, &Environment{Surfacer: projected.Surfacer, Projection: projected.Projection})
+}
+
+// energy returns the sum of the energy of the terms.
+func energy(terms []EnergyTerm, path *geo.Path, env *Environment) float64 {
+	sum := 0.0
+	for _, term := range terms {
+		sum += term.Energy(path, env)
+	}
+
+	return sum
+}
+
+// valueForcer is implemented by the built in terms that can return their force by value,
+// so computing the forces does not allocate.
+type valueForcer interface {
+	forceValue(path *geo.Path, index int, env *Environment) geo.Point
+}
+
+// force returns the sum of the contributions of the terms for the vertex at the index of the path.
+func force(terms []EnergyTerm, path *geo.Path, index int, env *Environment) geo.Point {
+	var sum geo.Point
+	for _, term := range terms {
+		if forcer, ok := term.(valueForcer); ok {
+			f := forcer.forceValue(path, index, env)
+			sum.Add(&f)
+		} else {
+			sum.Add(term.Force(path, index, env))
+		}
+	}
+
+	return sum
+}
+
+// objective implements the Objective interface for the terms.
+type objective struct {
+	terms []EnergyTerm
+	env   *Environment
+}
+
+func (o objective) Energy(path *geo.Path) float64 {
+	return energy(o.terms, path, o.env)
+}
+
+func (o objective) Forces(path *geo.Path) []geo.Point {
+	forces := make([]geo.Point, path.Length())
+	for i := 1; i < path.Length()-1; i++ {
+		forces[i] = force(o.terms, path, i, o.env)
+	}
+
+	return forces
+}
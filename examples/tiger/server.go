@@ -102,8 +102,25 @@ func slideHandler(w http.ResponseWriter, r *http.Request) {
 		slider.NumberIntermediateGeometries = int(numberIntermediatePaths)
 	}
 
-	// run the slide
-	slideResult, err := slider.Do()
+	/**********************************
+	 * slide schedule, the first stage with the options above,
+	 * then more stages with progressively sharper surfaces */
+	stages := []slide.Stage{slider.Stage(tigerSurfacer.SmoothingStdDev)}
+	for i := tigerSurfacer.SmoothingStdDev - 1; i >= 1.0; i -= 1.0 {
+		stage := slider.Stage(i)
+
+		// different parameters for this refinement step.
+		stage.DepthBasedReduction = true
+		stage.ResampleInterval = 3.0
+		stage.GradientScale /= 3.0
+		stage.MomentumScale = 0.0
+		stage.MaxLoops = stage.MinLoops // cap loops
+
+		stages = append(stages, stage)
+	}
+
+	// run the slide, stopping if the browser disconnects
+	slideResult, err := slider.DoSchedule(r.Context(), stages)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Server Error: %v", err), http.StatusServiceUnavailable)
 		return
@@ -123,33 +140,6 @@ func slideHandler(w http.ResponseWriter, r *http.Request) {
 		result.IntermediatePaths[i] = g[0].Encode(1e6)
 	}
 
-	/**********************************
-	 * more slides with progressively sharper surfaces */
-	for i := tigerSurfacer.SmoothingStdDev - 1; i >= 1.0; i -= 1.0 {
-		tigerSurfacer.SmoothingStdDev = i
-		tigerSurfacer.Resmooth()
-
-		slider = slide.New(slideResult.CorrectedGeometry, tigerSurfacer)
-
-		// different parameters for this refinement step.
-		slider.DepthBasedReduction = true
-		slider.ThresholdEpsilon = defaultThresholdEpsilon
-		slider.ResampleInterval = 3.0
-		slider.GradientScale /= 3.0
-		slider.MomentumScale = 0.0
-
-		slider.NumberIntermediateGeometries = 0
-		slider.MaxLoops = slider.MinLoops // cap loops
-
-		slideResult, err = slider.Do()
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Server Error: %v", err), http.StatusServiceUnavailable)
-			return
-		}
-	}
-
-	result.Corrected = slideResult.CorrectedGeometry[0].Encode(1e6)
-
 	/**********************************
 	 * deliver the result */
 	json, _ := json.Marshal(result)
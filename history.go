@@ -0,0 +1,70 @@
+package slide
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"math"
+	"strconv"
+)
+
+// A LoopRecord is the state of the refinement after a loop, see Slide.RecordHistory.
+// The scores are averaged over the paths, Delta and MaxMovement are the maximum
+// of the paths and Energy is the total of all the paths.
+type LoopRecord struct {
+	Loop        int     `json:"loop"`
+	PathScore   float64 `json:"path_score"`
+	Score       float64 `json:"score"`
+	Delta       float64 `json:"delta"`
+	Energy      float64 `json:"energy"`
+	MaxMovement float64 `json:"max_movement"` // meters
+}
+
+// History is the record of every loop of the refinement, in order.
+type History []LoopRecord
+
+// WriteCSV writes the history as CSV with a header row.
+func (h History) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"loop", "path_score", "score", "delta", "energy", "max_movement"})
+
+	for _, r := range h {
+		writer.Write([]string{
+			strconv.Itoa(r.Loop),
+			strconv.FormatFloat(r.PathScore, 'g', -1, 64),
+			strconv.FormatFloat(r.Score, 'g', -1, 64),
+			strconv.FormatFloat(r.Delta, 'g', -1, 64),
+			strconv.FormatFloat(r.Energy, 'g', -1, 64),
+			strconv.FormatFloat(r.MaxMovement, 'g', -1, 64),
+		})
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteJSON writes the history as a JSON array of records.
+func (h History) WriteJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(h)
+}
+
+// record returns the combined state of all the paths after the loop.
+// Paths that converged in earlier loops keep their last score and did not move.
+func record(loop int, states []*pathState, terms []EnergyTerm) LoopRecord {
+	r := LoopRecord{Loop: loop}
+	for _, state := range states {
+		r.PathScore += state.PathScore / float64(len(states))
+		r.Score += state.Score / float64(len(states))
+		r.Delta = math.Max(r.Delta, state.Delta)
+
+		// the energy of the loop state is reused, it may already be computed for convergence.
+		if state.Last != nil && state.Last.Loop == loop {
+			r.Energy += state.Last.Energy()
+			r.MaxMovement = math.Max(r.MaxMovement, state.Last.MaxMovement)
+		} else {
+			r.Energy += energy(terms, state.Path, state.Env)
+		}
+	}
+
+	return r
+}
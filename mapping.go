@@ -0,0 +1,170 @@
+package slide
+
+import (
+	"sort"
+
+	"github.com/paulmach/go.geo"
+)
+
+// A MappedVertex is where an input vertex ended up in the corrected geometry, see Result.Vertices.
+type MappedVertex struct {
+	Point geo.Point // lat/lng (EPSG:4326), exactly the input if it did not move, such as pinned vertices
+
+	// Index of the vertex in the corrected path, -1 if it is not one of the vertices,
+	// such as when it was removed by the GeoReducer. Always set if ReuseVertices is set.
+	Index int
+}
+
+// movedVertex is the location of an input vertex on a refined segment path.
+type movedVertex struct {
+	Point    *geo.Point
+	Distance float64 // along the refined path
+}
+
+// movedVertices returns, for every segment, where its input vertices are on the refined,
+// projected, segment path. The vertices keep their fraction of the length of the segment.
+func (net *network) movedVertices(paths []*geo.Path) [][]movedVertex {
+	moved := make([][]movedVertex, len(paths))
+	for i, path := range paths {
+		original := cumulativeLengths(net.Originals[i])
+		along := cumulativeLengths(path)
+
+		originalLength := original[len(original)-1]
+		length := along[len(along)-1]
+
+		moved[i] = make([]movedVertex, len(original))
+		for k := range original {
+			fraction := 0.0
+			if originalLength != 0 {
+				fraction = original[k] / originalLength
+			}
+
+			distance := fraction * length
+			point := pointAlong(path, along, distance)
+
+			// the ends are exact, they are junctions or the path endpoints.
+			if k == 0 {
+				point = path.GetAt(0).Clone()
+			} else if k == len(original)-1 {
+				point = path.GetAt(path.Length() - 1).Clone()
+				distance = length
+			}
+
+			moved[i][k] = movedVertex{Point: point, Distance: distance}
+		}
+	}
+
+	return moved
+}
+
+// reuseVertices builds the output segment paths, in lat/lng, from the moved input vertices.
+// The refined path between two input vertices is simplified by the GeoReducer so
+// new vertices are only added where the input vertices do not follow the refined path.
+// Only spans ending at an input path endpoint are trimmed, see geoReduce.
+func (s *Slide) reuseVertices(net *network, paths []*geo.Path, moved [][]movedVertex) []*geo.Path {
+	result := make([]*geo.Path, len(paths))
+	for i, path := range paths {
+		startsPath, endsPath := net.endpoints(i)
+		along := cumulativeLengths(path)
+		result[i] = geo.NewPath()
+
+		next := 1
+		for k := 0; k < len(moved[i])-1; k++ {
+			start, end := moved[i][k], moved[i][k+1]
+
+			span := geo.NewPath()
+			span.Push(start.Point)
+			for ; next < path.Length()-1 && along[next] < end.Distance; next++ {
+				if along[next] > start.Distance {
+					span.Push(path.GetAt(next))
+				}
+			}
+			span.Push(end.Point)
+
+			first, last := net.inverse(i, k, start.Point), net.inverse(i, k+1, end.Point)
+			span.Transform(s.Projection.Inverse)
+
+			if span.Length() > 2 {
+				span = s.geoReduce(span, startsPath && k == 0, endsPath && k == len(moved[i])-2)
+			}
+
+			// the input vertices are always kept as is
+			*span.GetAt(0), *span.GetAt(span.Length() - 1) = first, last
+
+			j := 0
+			if k > 0 {
+				j = 1 // same as the last point of the previous span
+			}
+			for ; j < span.Length(); j++ {
+				result[i].Push(span.GetAt(j))
+			}
+		}
+	}
+
+	return result
+}
+
+// mapVertices returns where every input vertex is in the joined, lat/lng, corrected geometry.
+// Input is the geometry before closing rings so the closing vertex is only included if given.
+func (net *network) mapVertices(moved [][]movedVertex, corrected, input []*geo.Path) [][]MappedVertex {
+	mapped := make([][]MappedVertex, len(net.Geometry))
+	for i, seg := range net.Segments {
+		for k, m := range moved[i] {
+			if k == 0 && mapped[seg.Path] != nil {
+				continue // same as the last vertex of the previous segment
+			}
+
+			mapped[seg.Path] = append(mapped[seg.Path], MappedVertex{Point: net.inverse(i, k, m.Point), Index: -1})
+		}
+	}
+
+	for p, vertices := range mapped {
+		mapped[p] = vertices[:input[p].Length()]
+
+		// vertices are in order along the output path
+		output := corrected[p]
+		cursor := 0
+		for k := range mapped[p] {
+			for j := cursor; j < output.Length(); j++ {
+				if *output.GetAt(j) == mapped[p][k].Point {
+					mapped[p][k].Index = j
+					cursor = j
+					break
+				}
+			}
+		}
+	}
+
+	return mapped
+}
+
+// cumulativeLengths returns the distance along the path to every vertex.
+func cumulativeLengths(path *geo.Path) []float64 {
+	lengths := make([]float64, path.Length())
+	for i := 1; i < path.Length(); i++ {
+		lengths[i] = lengths[i-1] + path.GetAt(i).DistanceFrom(path.GetAt(i-1))
+	}
+
+	return lengths
+}
+
+// pointAlong returns the point at the distance along the path,
+// cumulative are the distances to the vertices, see cumulativeLengths.
+func pointAlong(path *geo.Path, cumulative []float64, distance float64) *geo.Point {
+	i := sort.SearchFloat64s(cumulative, distance)
+	if i == 0 {
+		return path.GetAt(0).Clone()
+	}
+
+	if i >= path.Length() {
+		return path.GetAt(path.Length() - 1).Clone()
+	}
+
+	segment := cumulative[i] - cumulative[i-1]
+	if segment == 0 {
+		return path.GetAt(i).Clone()
+	}
+
+	t := (distance - cumulative[i-1]) / segment
+	return path.GetAt(i).Clone().Subtract(path.GetAt(i - 1)).Scale(t).Add(path.GetAt(i - 1))
+}
@@ -0,0 +1,36 @@
+package slide
+
+import (
+	"testing"
+
+	"github.com/paulmach/go.geo"
+)
+
+func TestMappedVertexExact(t *testing.T) {
+	input := geo.NewPath()
+	input.Push(geo.NewPoint(-122.0, 37.0))
+	input.Push(geo.NewPoint(-121.995, 37.0002))
+	input.Push(geo.NewPoint(-121.99, 37.0004))
+
+	for _, reuse := range []bool{false, true} {
+		s := New([]*geo.Path{input}, benchSurfacer{})
+		s.Constraints = []Constraint{{Vertex: VertexRef{Path: 0, Index: 1}, Radius: 0}}
+		s.ReuseVertices = reuse
+
+		result, err := s.Do()
+		if err != nil {
+			t.Fatalf("reuse %v: unexpected error: %v", reuse, err)
+		}
+
+		// the endpoints and the pinned vertex do not move, they are not projected and back.
+		for k, v := range result.Vertices[0] {
+			if v.Point != *input.GetAt(k) {
+				t.Errorf("reuse %v: vertex %d: expected %v, got %v", reuse, k, input.GetAt(k), v.Point)
+			}
+
+			if v.Index < 0 || *result.CorrectedGeometry[0].GetAt(v.Index) != *input.GetAt(k) {
+				t.Errorf("reuse %v: vertex %d: not in the corrected geometry, index %d", reuse, k, v.Index)
+			}
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package metrics
+
+import (
+	"math"
+
+	"github.com/paulmach/go.geo"
+)
+
+const (
+	earthRadius    = 6378137.0 // meters
+	sampleInterval = 1.0       // meters, along the path for offsets and area
+
+	// maxFrechetSamples limits the samples of each path for the Fréchet distance, it is quadratic.
+	maxFrechetSamples = 1000
+)
+
+// Summary is how much a path changed, all values are in meters, or square meters for the area.
+type Summary struct {
+	Hausdorff    float64
+	Frechet      float64 // discrete, on the paths sampled evenly, so it does not depend on the vertices
+	MeanOffset   float64
+	MaxOffset    float64
+	LengthChange float64 // corrected minus input, negative if shorter
+	Area         float64
+}
+
+// Compare computes all the metrics for the input and corrected paths, in lat/lng (EPSG:4326).
+func Compare(input, corrected *geo.Path) Summary {
+	a, b := project(input, corrected)
+	mean, max := offsets(a, b)
+
+	return Summary{
+		Hausdorff:    hausdorff(a, b),
+		Frechet:      sampledFrechet(a, b),
+		MeanOffset:   mean,
+		MaxOffset:    max,
+		LengthChange: b.Distance() - a.Distance(),
+		Area:         areaBetween(a, b),
+	}
+}
+
+// Hausdorff returns the largest distance, in meters, from a vertex of one path to the other path.
+func Hausdorff(a, b *geo.Path) float64 {
+	return hausdorff(project(a, b))
+}
+
+// DiscreteFrechet returns the discrete Fréchet distance, in meters, between the vertices of the paths.
+// It is the shortest leash that can connect two walkers going from the start to the end
+// of the paths, each only stepping forward from vertex to vertex.
+func DiscreteFrechet(a, b *geo.Path) float64 {
+	a, b = project(a, b)
+	return discreteFrechet(a.Points(), b.Points())
+}
+
+// Offset returns the mean and maximum distance, in meters, from the corrected path to the input path.
+// The corrected path is sampled every meter so the mean does not depend on its vertices.
+func Offset(input, corrected *geo.Path) (mean, max float64) {
+	return offsets(project(input, corrected))
+}
+
+// LengthChange returns the length of the corrected path minus the input path, in meters.
+func LengthChange(input, corrected *geo.Path) float64 {
+	a, b := project(input, corrected)
+	return b.Distance() - a.Distance()
+}
+
+// AreaBetween returns the area, in square meters, between the paths, both going the same direction.
+// Both paths are sampled at the same fractions of their length and the quadrilaterals between
+// the matching samples are summed. Where the paths cross the areas do not cancel out.
+func AreaBetween(a, b *geo.Path) float64 {
+	return areaBetween(project(a, b))
+}
+
+// project converts the paths into a local planar space, in meters, using an equirectangular
+// projection centered on the paths. It is accurate for paths up to a few tens of kilometers.
+func project(a, b *geo.Path) (*geo.Path, *geo.Path) {
+	bound := a.Bound().Union(b.Bound())
+	scale := math.Pi / 180 * earthRadius
+	cos := math.Cos(bound.Center().Lat() * math.Pi / 180)
+
+	projector := func(p *geo.Point) {
+		p.SetX(p.Lng() * scale * cos)
+		p.SetY(p.Lat() * scale)
+	}
+
+	return a.Clone().Transform(projector), b.Clone().Transform(projector)
+}
+
+func hausdorff(a, b *geo.Path) float64 {
+	max := 0.0
+	for i := 0; i < a.Length(); i++ {
+		max = math.Max(max, distanceToPath(a.GetAt(i), b))
+	}
+
+	for i := 0; i < b.Length(); i++ {
+		max = math.Max(max, distanceToPath(b.GetAt(i), a))
+	}
+
+	return max
+}
+
+// discreteFrechet uses the dynamic programming solution, keeping one row at a time.
+func discreteFrechet(a, b []geo.Point) float64 {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return 0
+	}
+
+	previous := make([]float64, m)
+	current := make([]float64, m)
+
+	for i := 0; i < n; i++ {
+		for j := 0; j < m; j++ {
+			d := a[i].DistanceFrom(&b[j])
+
+			switch {
+			case i == 0 && j == 0:
+				current[j] = d
+			case i == 0:
+				current[j] = math.Max(current[j-1], d)
+			case j == 0:
+				current[j] = math.Max(previous[j], d)
+			default:
+				reach := math.Min(previous[j], math.Min(previous[j-1], current[j-1]))
+				current[j] = math.Max(reach, d)
+			}
+		}
+
+		previous, current = current, previous
+	}
+
+	return previous[m-1]
+}
+
+// sampledFrechet is the discrete Fréchet distance of the paths sampled with the same number of points.
+func sampledFrechet(a, b *geo.Path) float64 {
+	n := maxInt(samplesFor(a), samplesFor(b))
+	if n > maxFrechetSamples {
+		n = maxFrechetSamples
+	}
+
+	as, bs := sample(a, n), sample(b, n)
+	return discreteFrechet(as, bs)
+}
+
+func offsets(input, corrected *geo.Path) (mean, max float64) {
+	samples := sample(corrected, samplesFor(corrected))
+	if len(samples) == 0 {
+		return 0, 0
+	}
+
+	for _, p := range samples {
+		d := distanceToPath(&p, input)
+		mean += d
+		max = math.Max(max, d)
+	}
+
+	return mean / float64(len(samples)), max
+}
+
+func areaBetween(a, b *geo.Path) float64 {
+	n := maxInt(samplesFor(a), samplesFor(b))
+	as, bs := sample(a, n), sample(b, n)
+
+	area := 0.0
+	for i := 1; i < n; i++ {
+		area += math.Abs(quadArea(&as[i-1], &as[i], &bs[i], &bs[i-1]))
+	}
+
+	return area
+}
+
+// samplesFor returns the number of samples for the path, one every sampleInterval.
+func samplesFor(path *geo.Path) int {
+	return maxInt(2, int(math.Ceil(path.Distance()/sampleInterval))+1)
+}
+
+// sample returns n points evenly spaced along the path, including the endpoints.
+func sample(path *geo.Path, n int) []geo.Point {
+	if path.Length() == 0 {
+		return nil
+	}
+
+	if path.Length() == 1 {
+		samples := make([]geo.Point, n)
+		for i := range samples {
+			samples[i] = *path.GetAt(0)
+		}
+
+		return samples
+	}
+
+	return path.Clone().Resample(n).Points()
+}
+
+// quadArea is the signed area of the quadrilateral using the shoelace formula.
+func quadArea(a, b, c, d *geo.Point) float64 {
+	return ((a.X()*b.Y() - b.X()*a.Y()) +
+		(b.X()*c.Y() - c.X()*b.Y()) +
+		(c.X()*d.Y() - d.X()*c.Y()) +
+		(d.X()*a.Y() - a.X()*d.Y())) / 2
+}
+
+func distanceToPath(point *geo.Point, path *geo.Path) float64 {
+	if path.Length() == 1 {
+		return point.DistanceFrom(path.GetAt(0))
+	}
+
+	min := math.Inf(1)
+	for i := 1; i < path.Length(); i++ {
+		min = math.Min(min, distanceToSegment(point, path.GetAt(i-1), path.GetAt(i)))
+	}
+
+	return min
+}
+
+func distanceToSegment(point, a, b *geo.Point) float64 {
+	ab := b.Clone().Subtract(a)
+	ap := point.Clone().Subtract(a)
+
+	t := 0.0
+	if dot := ab.Dot(ab); dot != 0 {
+		t = math.Max(0, math.Min(1, ap.Dot(ab)/dot))
+	}
+
+	return ab.Scale(t).Add(a).DistanceFrom(point)
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}
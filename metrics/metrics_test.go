@@ -0,0 +1,136 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+
+	"github.com/paulmach/go.geo"
+)
+
+// meters per degree, at the equator, as used by project.
+var degree = math.Pi / 180 * earthRadius
+
+func path(points ...[2]float64) *geo.Path {
+	p := geo.NewPath()
+	for _, point := range points {
+		p.Push(geo.NewPoint(point[0], point[1]))
+	}
+
+	return p
+}
+
+func equal(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6*math.Max(1, math.Abs(b))
+}
+
+func TestCompareParallel(t *testing.T) {
+	// two parallel lines along the equator, 0.0001 degrees apart.
+	input := path([2]float64{0, 0}, [2]float64{0.005, 0}, [2]float64{0.01, 0})
+	corrected := path([2]float64{0, 0.0001}, [2]float64{0.01, 0.0001})
+
+	// the center is at latitude 0.00005, so east-west distances are scaled slightly.
+	gap := 0.0001 * degree
+	length := 0.01 * degree * math.Cos(0.00005*math.Pi/180)
+
+	summary := Compare(input, corrected)
+	expected := Summary{
+		Hausdorff:    gap,
+		Frechet:      gap,
+		MeanOffset:   gap,
+		MaxOffset:    gap,
+		LengthChange: 0,
+		Area:         length * gap,
+	}
+
+	for _, c := range []struct {
+		name             string
+		actual, expected float64
+	}{
+		{"hausdorff", summary.Hausdorff, expected.Hausdorff},
+		{"frechet", summary.Frechet, expected.Frechet},
+		{"mean offset", summary.MeanOffset, expected.MeanOffset},
+		{"max offset", summary.MaxOffset, expected.MaxOffset},
+		{"length change", summary.LengthChange, expected.LengthChange},
+		{"area", summary.Area, expected.Area},
+	} {
+		if !equal(c.actual, c.expected) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.expected, c.actual)
+		}
+	}
+
+	if v := Hausdorff(input, corrected); !equal(v, gap) {
+		t.Errorf("hausdorff: expected %v, got %v", gap, v)
+	}
+
+	if mean, max := Offset(input, corrected); !equal(mean, gap) || !equal(max, gap) {
+		t.Errorf("offset: expected %v %v, got %v %v", gap, gap, mean, max)
+	}
+
+	if v := AreaBetween(input, corrected); !equal(v, length*gap) {
+		t.Errorf("area: expected %v, got %v", length*gap, v)
+	}
+}
+
+func TestHausdorff(t *testing.T) {
+	// a bump in the middle of the corrected path.
+	input := path([2]float64{0, 0}, [2]float64{0.01, 0})
+	corrected := path([2]float64{0, 0}, [2]float64{0.005, 0.0002}, [2]float64{0.01, 0})
+
+	expected := 0.0002 * degree
+	if v := Hausdorff(input, corrected); !equal(v, expected) {
+		t.Errorf("expected %v, got %v", expected, v)
+	}
+
+	// same the other way around
+	if v := Hausdorff(corrected, input); !equal(v, expected) {
+		t.Errorf("reversed: expected %v, got %v", expected, v)
+	}
+}
+
+func TestDiscreteFrechet(t *testing.T) {
+	a := path([2]float64{0, 0}, [2]float64{0.001, 0}, [2]float64{0.002, 0})
+
+	if v := DiscreteFrechet(a, a); v != 0 {
+		t.Errorf("same path: expected 0, got %v", v)
+	}
+
+	// walking in opposite directions, the walkers start at opposite ends.
+	b := path([2]float64{0.002, 0}, [2]float64{0.001, 0}, [2]float64{0, 0})
+	if v, expected := DiscreteFrechet(a, b), 0.002*degree; !equal(v, expected) {
+		t.Errorf("reversed: expected %v, got %v", expected, v)
+	}
+
+	// the Hausdorff distance is zero but the walkers must go back.
+	c := path([2]float64{0, 0}, [2]float64{0.002, 0}, [2]float64{0, 0}, [2]float64{0.002, 0})
+	if v, expected := DiscreteFrechet(a, c), 0.001*degree; !equal(v, expected) {
+		t.Errorf("back and forth: expected %v, got %v", expected, v)
+	}
+}
+
+func TestLengthChange(t *testing.T) {
+	input := path([2]float64{0, 0}, [2]float64{0.01, 0})
+	corrected := path([2]float64{0, 0}, [2]float64{0.015, 0})
+
+	if v, expected := LengthChange(input, corrected), 0.005*degree; !equal(v, expected) {
+		t.Errorf("longer: expected %v, got %v", expected, v)
+	}
+
+	if v, expected := LengthChange(corrected, input), -0.005*degree; !equal(v, expected) {
+		t.Errorf("shorter: expected %v, got %v", expected, v)
+	}
+}
+
+func TestAreaBetween(t *testing.T) {
+	// a triangle, the corrected path goes up to a point and back down.
+	input := path([2]float64{0, 0}, [2]float64{0.002, 0})
+	corrected := path([2]float64{0, 0}, [2]float64{0.001, 0.001}, [2]float64{0.002, 0})
+
+	cos := math.Cos(0.0005 * math.Pi / 180)
+	expected := 0.002 * degree * cos * 0.001 * degree / 2
+
+	// the samples are at the same fractions of the length, not straight across,
+	// so the area of the quadrilaterals is close to but not exactly the triangle.
+	if v := AreaBetween(input, corrected); math.Abs(v-expected) > 0.01*expected {
+		t.Errorf("expected %v, got %v", expected, v)
+	}
+}
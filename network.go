@@ -0,0 +1,492 @@
+package slide
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/paulmach/go.geo"
+)
+
+// A VertexRef references the vertex at Index of the path Geometry[Path].
+type VertexRef struct {
+	Path  int
+	Index int
+}
+
+// A Junction is a set of input vertices, on one or more paths, that are the same
+// location, such as a road intersection. The junction is moved as one vertex using
+// the combined contributions of all the incident paths so the vertices will
+// still be the same location after sliding.
+type Junction []VertexRef
+
+// A Constraint limits how far an input vertex can move during the slide.
+// A Radius of zero pins the vertex in place. Path endpoints are pinned by default,
+// a constraint with a non-zero radius allows them to move within that radius.
+type Constraint struct {
+	Vertex VertexRef
+	Radius float64 // meters
+}
+
+// NewNetwork creates a new Slide structure, with the default parameters,
+// that will slide the paths as a network connected at the given junctions.
+func NewNetwork(geometry []*geo.Path, junctions []Junction, surfacer Surfacer) *Slide {
+	s := New(geometry, surfacer)
+	s.Junctions = junctions
+
+	return s
+}
+
+// segment is the part of an input path between two consecutive
+// path endpoints or junctions. Segments are what actually get slid.
+type segment struct {
+	Path  int // index of the input path
+	Start int // input vertex index of the first point
+	End   int // input vertex index of the last point
+}
+
+// segmentEnd is one of the endpoints of a segment.
+type segmentEnd struct {
+	Segment int
+	First   bool
+}
+
+// point returns the endpoint of the segment path.
+func (e segmentEnd) point(paths []*geo.Path) *geo.Point {
+	if e.First {
+		return paths[e.Segment].GetAt(0)
+	}
+
+	return paths[e.Segment].GetAt(paths[e.Segment].Length() - 1)
+}
+
+// neighbour returns the point next to the endpoint on the segment path.
+func (e segmentEnd) neighbour(paths []*geo.Path) *geo.Point {
+	if e.First {
+		return paths[e.Segment].GetAt(1)
+	}
+
+	return paths[e.Segment].GetAt(paths[e.Segment].Length() - 2)
+}
+
+// network is the input geometry split into segments at the junctions.
+type network struct {
+	Geometry  []*geo.Path // input paths, lat/lng (EPSG:4326), rings are closed
+	Segments  []segment
+	Junctions []*junctionState
+	Closed    bool // rings have no endpoints, the segments are split at artificial junctions
+
+	// Projection is the planar space of the segment paths.
+	Projection Projection
+
+	// Originals are the segment paths, projected, before resampling and refinement.
+	// Inputs are the same paths in lat/lng.
+	Originals []*geo.Path
+	Inputs    []*geo.Path
+}
+
+// junctionState is the refinement state of a junction or a constrained vertex,
+// it is the shared endpoint of the segments.
+type junctionState struct {
+	Vertices  []VertexRef
+	Ends      []segmentEnd
+	Optimizer Optimizer // the junction is vertex 1 of a virtual path, see junctionObjective
+
+	// Radius is the maximum distance from Origin the junction can move.
+	// It is in meters until converted to projected units by setOrigins.
+	Radius float64
+	Origin geo.Point
+}
+
+// buildNetwork splits the input geometry into segments at the junctions.
+// Without junctions every input path is one segment.
+// Closed rings are joined at their first/last vertex so no endpoint is fixed.
+func (s *Slide) buildNetwork() (*network, error) {
+	geometry := s.Geometry
+	if s.Closed {
+		geometry = closeRings(geometry)
+	}
+
+	splits := make([]map[int]bool, len(geometry))
+	for i, p := range geometry {
+		splits[i] = map[int]bool{0: true, p.Length() - 1: true}
+	}
+
+	var junctions []*junctionState
+	seen := make(map[VertexRef]*junctionState)
+	for i, junction := range s.Junctions {
+		if len(junction) < 2 {
+			return nil, fmt.Errorf("slide: junction[%d] has less than 2 vertices", i)
+		}
+
+		state := &junctionState{Radius: math.Inf(1)}
+		for _, ref := range junction {
+			if !validVertex(geometry, ref) {
+				return nil, fmt.Errorf("slide: junction[%d] vertex %v out of range", i, ref)
+			}
+
+			if seen[ref] != nil {
+				return nil, fmt.Errorf("slide: junction[%d] vertex %v in more than one junction", i, ref)
+			}
+
+			seen[ref] = state
+			state.Vertices = append(state.Vertices, ref)
+		}
+
+		junctions = append(junctions, state)
+	}
+
+	// the first and last vertex of a ring are the same vertex.
+	if s.Closed {
+		for i, p := range geometry {
+			first := VertexRef{Path: i, Index: 0}
+			last := VertexRef{Path: i, Index: p.Length() - 1}
+
+			if seen[last] != nil {
+				return nil, fmt.Errorf("slide: ring geometry[%d] closing vertex %v must not be in a junction", i, last)
+			}
+
+			state := seen[first]
+			if state == nil {
+				state = &junctionState{
+					Vertices: []VertexRef{first},
+					Radius:   math.Inf(1),
+				}
+
+				seen[first] = state
+				junctions = append(junctions, state)
+			}
+
+			seen[last] = state
+			state.Vertices = append(state.Vertices, last)
+
+			// also split the ring in the middle so no segment is closed.
+			// Reducers, such as Douglas-Peucker, expect distinct endpoints.
+			middle := VertexRef{Path: i, Index: (p.Length() - 1) / 2}
+			if seen[middle] == nil {
+				state := &junctionState{
+					Vertices: []VertexRef{middle},
+					Radius:   math.Inf(1),
+				}
+
+				seen[middle] = state
+				junctions = append(junctions, state)
+			}
+		}
+	}
+
+	// constrained vertices that are not part of a junction become a junction of one vertex.
+	for i, constraint := range s.Constraints {
+		if !validVertex(geometry, constraint.Vertex) {
+			return nil, fmt.Errorf("slide: constraint[%d] vertex %v out of range", i, constraint.Vertex)
+		}
+
+		if constraint.Radius < 0 {
+			return nil, fmt.Errorf("slide: constraint[%d] radius is negative", i)
+		}
+
+		if state := seen[constraint.Vertex]; state != nil {
+			state.Radius = math.Min(state.Radius, constraint.Radius)
+			continue
+		}
+
+		state := &junctionState{
+			Vertices: []VertexRef{constraint.Vertex},
+			Radius:   constraint.Radius,
+		}
+
+		seen[constraint.Vertex] = state
+		junctions = append(junctions, state)
+	}
+
+	for ref := range seen {
+		splits[ref.Path][ref.Index] = true
+	}
+
+	var segments []segment
+	for i := range geometry {
+		indexes := make([]int, 0, len(splits[i]))
+		for index := range splits[i] {
+			indexes = append(indexes, index)
+		}
+		sort.Ints(indexes)
+
+		for j := 1; j < len(indexes); j++ {
+			segments = append(segments, segment{Path: i, Start: indexes[j-1], End: indexes[j]})
+		}
+	}
+
+	for _, junction := range junctions {
+		for _, ref := range junction.Vertices {
+			for j, seg := range segments {
+				if seg.Path != ref.Path {
+					continue
+				}
+
+				if seg.Start == ref.Index {
+					junction.Ends = append(junction.Ends, segmentEnd{Segment: j, First: true})
+				}
+
+				if seg.End == ref.Index {
+					junction.Ends = append(junction.Ends, segmentEnd{Segment: j, First: false})
+				}
+			}
+		}
+	}
+
+	return &network{
+		Geometry:  geometry,
+		Segments:  segments,
+		Junctions: junctions,
+		Closed:    s.Closed,
+	}, nil
+}
+
+// segmentPaths returns copies of the parts of the input geometry for each segment.
+// The endpoints of the segments at a junction are all set to the location of
+// the first vertex of the junction.
+func (net *network) segmentPaths() []*geo.Path {
+	paths := make([]*geo.Path, len(net.Segments))
+	for i, seg := range net.Segments {
+		input := net.Geometry[seg.Path]
+
+		paths[i] = geo.NewPath()
+		for j := seg.Start; j <= seg.End; j++ {
+			paths[i].Push(input.GetAt(j))
+		}
+	}
+
+	for _, junction := range net.Junctions {
+		ref := junction.Vertices[0]
+		point := net.Geometry[ref.Path].GetAt(ref.Index)
+		for _, end := range junction.Ends {
+			*end.point(paths) = *point
+		}
+	}
+
+	return paths
+}
+
+// validVertex checks if the reference is to a vertex of the geometry.
+func validVertex(geometry []*geo.Path, ref VertexRef) bool {
+	return ref.Path >= 0 && ref.Path < len(geometry) &&
+		ref.Index >= 0 && ref.Index < geometry[ref.Path].Length()
+}
+
+// setOrigins records the initial location of the projected segments and junctions
+// and converts the radius constraints from meters using the scale at the junction.
+func (net *network) setOrigins(paths []*geo.Path, projection Projection) {
+	net.Projection = projection
+
+	net.Inputs = net.segmentPaths()
+	net.Originals = make([]*geo.Path, len(paths))
+	for i, p := range paths {
+		net.Originals[i] = p.Clone()
+	}
+	for _, junction := range net.Junctions {
+		junction.Origin = *junction.Ends[0].point(paths)
+		junction.Radius *= projection.ScaleFactor(&junction.Origin)
+	}
+}
+
+// inverse transforms the refined, projected, point of input vertex k of the segment back to lat/lng.
+// Ends that did not move, such as path endpoints and pinned vertices, are the exact input
+// location, projecting there and back may not give exactly the same coordinates.
+func (net *network) inverse(segment, k int, point *geo.Point) geo.Point {
+	original := net.Originals[segment]
+	if (k == 0 || k == original.Length()-1) && *point == *original.GetAt(k) {
+		return *net.Inputs[segment].GetAt(k)
+	}
+
+	return *point.Clone().Transform(net.Projection.Inverse)
+}
+
+// separated returns the segments that should be kept apart from the segment,
+// those of other input paths that do not share a junction with it.
+func (net *network) separated(segment int) []int {
+	connected := make(map[int]bool)
+	for _, junction := range net.Junctions {
+		shared := false
+		for _, end := range junction.Ends {
+			shared = shared || end.Segment == segment
+		}
+
+		if shared {
+			for _, end := range junction.Ends {
+				connected[end.Segment] = true
+			}
+		}
+	}
+
+	var segments []int
+	for i, seg := range net.Segments {
+		if seg.Path != net.Segments[segment].Path && !connected[i] {
+			segments = append(segments, i)
+		}
+	}
+
+	return segments
+}
+
+// endpoints returns if the first and last vertex of the segment are endpoints of the input path.
+// The other segment ends are junctions, constrained vertices or ring splits that continue into the next segment.
+func (net *network) endpoints(segment int) (first, last bool) {
+	if net.Closed {
+		return false, false
+	}
+
+	seg := net.Segments[segment]
+	return seg.Start == 0, seg.End == net.Geometry[seg.Path].Length()-1
+}
+
+// join concatenates the segment paths back into paths matching the input geometry.
+func (net *network) join(paths []*geo.Path) []*geo.Path {
+	joined := make([]*geo.Path, len(net.Geometry))
+	for i, seg := range net.Segments {
+		if joined[seg.Path] == nil {
+			joined[seg.Path] = paths[i].Clone()
+			continue
+		}
+
+		// first point is the same as the last point of the previous segment
+		for j := 1; j < paths[i].Length(); j++ {
+			joined[seg.Path].Push(paths[i].GetAt(j))
+		}
+	}
+
+	return joined
+}
+
+// progress builds the LoopProgress for the input paths from the state of the segments.
+func (net *network) progress(loop int, states []*pathState) *LoopProgress {
+	progress := &LoopProgress{
+		Loop:       loop,
+		PathScores: make([]float64, len(net.Geometry)),
+		Scores:     make([]float64, len(net.Geometry)),
+		Deltas:     make([]float64, len(net.Geometry)),
+	}
+
+	paths := make([]*geo.Path, len(states))
+	counts := make([]int, len(net.Geometry))
+	for i, state := range states {
+		paths[i] = state.Path.Clone().Transform(net.Projection.Inverse)
+
+		p := net.Segments[i].Path
+		n := state.Path.Length()
+
+		counts[p] += n
+		progress.PathScores[p] += state.PathScore * float64(n)
+		progress.Scores[p] += state.Score * float64(n)
+		progress.Deltas[p] = math.Max(progress.Deltas[p], state.Delta)
+	}
+
+	for p := range counts {
+		progress.PathScores[p] /= float64(counts[p])
+		progress.Scores[p] /= float64(counts[p])
+	}
+
+	progress.Geometry = net.join(paths)
+	return progress
+}
+
+// junctionCorrection computes the correction of the junction as if it were one vertex.
+// The forces of the terms are averaged over virtual paths through every pair of incident segments
+// and turned into the correction by the Optimizer of the junction.
+// The result is limited so the junction stays within its radius constraint and MaxDisplacement.
+func (s *Slide) junctionCorrection(net *network, terms []EnergyTerm, paths []*geo.Path, junction *junctionState) geo.Point {
+	if junction.Radius == 0 {
+		return geo.Point{} // pinned
+	}
+
+	point := junction.Ends[0].point(paths)
+
+	origin := geo.NewPath()
+	origin.Push(&junction.Origin)
+	env := &Environment{Surfacer: s.Surfacer, Projection: net.Projection, Original: origin}
+
+	neighbours := make([]*geo.Point, 0, 2)
+	for _, end := range junction.Ends {
+		neighbours = append(neighbours, end.neighbour(paths))
+	}
+
+	if len(neighbours) == 1 {
+		// a constrained vertex at the end of a path, mirror the neighbour
+		// so the path terms have no effect, like a straight, evenly spaced path.
+		neighbours = append(neighbours, point.Clone().Scale(2).Subtract(neighbours[0]))
+	}
+
+	objective := junctionObjective{terms: terms, env: env, neighbours: neighbours}
+
+	path := geo.NewPath()
+	path.Push(neighbours[0])
+	path.Push(point)
+	path.Push(neighbours[1])
+
+	// like a path, the depth based reduction and the radius are applied in place.
+	correction := &junction.Optimizer.Step(path, objective.Forces(path), objective)[1]
+	if s.DepthBasedReduction {
+		v := s.Surfacer.ValueAt(point)
+		correction.Scale(math.Sqrt(1.0 - v))
+	}
+
+	radius := junction.Radius
+	if s.MaxDisplacement > 0 {
+		radius = math.Min(radius, s.MaxDisplacement*net.Projection.ScaleFactor(&junction.Origin))
+	}
+
+	// keep the new location within the radius of the origin
+	moved := point.Clone().Add(correction)
+	if d := moved.DistanceFrom(&junction.Origin); d > radius {
+		moved.Subtract(&junction.Origin).Scale(radius / d).Add(&junction.Origin)
+		*correction = *moved.Subtract(point)
+	}
+
+	return *correction
+}
+
+// junctionObjective is the objective of a junction as one vertex, vertex 1 of the path.
+// The energy and force are averaged over the virtual paths through the junction,
+// from the neighbour on one segment to the neighbour on another.
+type junctionObjective struct {
+	terms      []EnergyTerm
+	env        *Environment
+	neighbours []*geo.Point
+}
+
+func (o junctionObjective) Energy(path *geo.Path) float64 {
+	sum, pairs := 0.0, 0
+	o.pairs(path.GetAt(1), func(p *geo.Path) {
+		sum += energy(o.terms, p, o.env)
+		pairs++
+	})
+
+	return sum / float64(pairs)
+}
+
+func (o junctionObjective) Forces(path *geo.Path) []geo.Point {
+	forces := make([]geo.Point, path.Length())
+
+	pairs := 0
+	o.pairs(path.GetAt(1), func(p *geo.Path) {
+		f := force(o.terms, p, 1, o.env)
+		forces[1].Add(&f)
+		pairs++
+	})
+
+	forces[1].Scale(1.0 / float64(pairs))
+	return forces
+}
+
+// pairs calls f with the virtual path through the point for every pair of neighbours.
+func (o junctionObjective) pairs(point *geo.Point, f func(*geo.Path)) {
+	for i := 0; i < len(o.neighbours); i++ {
+		for j := i + 1; j < len(o.neighbours); j++ {
+			path := geo.NewPath()
+			path.Push(o.neighbours[i])
+			path.Push(point)
+			path.Push(o.neighbours[j])
+
+			f(path)
+		}
+	}
+}
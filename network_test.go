@@ -0,0 +1,109 @@
+package slide
+
+import (
+	"math"
+	"testing"
+
+	"github.com/paulmach/go.geo"
+)
+
+// frozen is an optimizer that never moves the vertices.
+type frozen struct{}
+
+func (frozen) Step(path *geo.Path, forces []geo.Point, objective Objective) []geo.Point {
+	return make([]geo.Point, len(forces))
+}
+
+func TestJunctionOptimizer(t *testing.T) {
+	geometry, junctions := junctionNetwork()
+	center := geometry[1].GetAt(0)
+
+	junction := func(s *Slide) *geo.Point {
+		result, err := s.Do()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		return result.CorrectedGeometry[1].GetAt(0)
+	}
+
+	s := NewNetwork(geometry, junctions, benchSurfacer{})
+	if p := junction(s); p.DistanceFrom(center) < 1e-6 {
+		t.Fatalf("expected the junction to move with the default optimizer, got %v", p)
+	}
+
+	// the junction uses the optimizer too.
+	s = NewNetwork(geometry, junctions, benchSurfacer{})
+	s.NewOptimizer = func() Optimizer { return frozen{} }
+
+	if p := junction(s); math.Abs(p.X()-center.X()) > 1e-9 || math.Abs(p.Y()-center.Y()) > 1e-9 {
+		t.Errorf("expected the junction to stay at %v, got %v", center, p)
+	}
+}
+
+func TestNetworkJunctions(t *testing.T) {
+	geometry, junctions := junctionNetwork()
+
+	result, err := NewNetwork(geometry, junctions, benchSurfacer{}).Do()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	west, east, north := result.CorrectedGeometry[0], result.CorrectedGeometry[1], result.CorrectedGeometry[2]
+
+	junction := *west.GetAt(west.Length() - 1)
+	if junction == *geometry[1].GetAt(0) {
+		t.Errorf("expected the junction to move")
+	}
+
+	if p := *east.GetAt(0); p != junction {
+		t.Errorf("east: expected the junction at %v, got %v", junction, p)
+	}
+
+	if p := *north.GetAt(0); p != junction {
+		t.Errorf("north: expected the junction at %v, got %v", junction, p)
+	}
+
+	for _, ref := range junctions[0] {
+		if p := result.Vertices[ref.Path][ref.Index].Point; p != junction {
+			t.Errorf("vertex %v: expected the junction at %v, got %v", ref, junction, p)
+		}
+	}
+}
+
+func TestConstraints(t *testing.T) {
+	input := geo.NewPath()
+	input.Push(geo.NewPoint(-122.0, 37.0))
+	input.Push(geo.NewPoint(-121.995, 37.0002))
+	input.Push(geo.NewPoint(-121.99, 37.0001))
+	input.Push(geo.NewPoint(-121.985, 37.0003))
+	input.Push(geo.NewPoint(-121.98, 37.0))
+
+	s := New([]*geo.Path{input}, benchSurfacer{})
+	s.Constraints = []Constraint{
+		{Vertex: VertexRef{Path: 0, Index: 1}, Radius: 0},
+		{Vertex: VertexRef{Path: 0, Index: 3}, Radius: 1},
+	}
+
+	result, err := s.Do()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	vertices := result.Vertices[0]
+
+	if p := vertices[1].Point; p != *input.GetAt(1) {
+		t.Errorf("pinned: expected %v, got %v", input.GetAt(1), p)
+	}
+
+	// the radius is in meters, allow for the scale of the projection at the vertex.
+	d := vertices[3].Point.GeoDistanceFrom(input.GetAt(3))
+	if d == 0 || d > 1.01 {
+		t.Errorf("radius: expected to move up to 1 meter, moved %v", d)
+	}
+
+	// the unconstrained vertex is free to move further.
+	if d := vertices[2].Point.GeoDistanceFrom(input.GetAt(2)); d <= 1 {
+		t.Errorf("unconstrained: expected to move more than 1 meter, moved %v", d)
+	}
+}
@@ -0,0 +1,281 @@
+package slide
+
+import (
+	"math"
+
+	"github.com/paulmach/go.geo"
+)
+
+// Defaults for the optimizers.
+const (
+	DefaultAdamLearningRate = 0.5 // projected units
+	DefaultLBFGSMemory      = 5
+)
+
+// An Optimizer turns the forces on the vertices of a path, the sum of the gradient,
+// distance and angle contributions, into the corrections applied every loop.
+// A new Optimizer is created for every path so implementations can keep per vertex state.
+// Junctions and constrained vertices also get their own, they are vertex 1 of a virtual
+// three vertex path through the junction.
+//
+// Path endpoints have zero force and their correction is ignored. If DepthBasedReduction
+// is set the returned corrections are scaled in place before being applied, as are junction
+// corrections limited to their radius. Implementations that keep them as state will see the reduced values.
+type Optimizer interface {
+	Step(path *geo.Path, forces []geo.Point, objective Objective) []geo.Point
+}
+
+// An Objective evaluates the current surface and parameters for a path.
+// It allows optimizers, such as ones that do a line search, to evaluate
+// paths other than the current one.
+type Objective interface {
+	// Energy of the path, lower is better. See PathEnergy.
+	Energy(path *geo.Path) float64
+
+	// Forces on the path vertices, the same as are passed to Step.
+	Forces(path *geo.Path) []geo.Point
+}
+
+// momentum is the default gradient descent where a fraction of
+// the previous correction is added to the current.
+type momentum struct {
+	scale       float64
+	corrections []geo.Point
+}
+
+// NewMomentum creates the default optimizer, gradient descent where scale times
+// the previous correction is added in. This is the MomentumScale of the Slide.
+func NewMomentum(scale float64) Optimizer {
+	return &momentum{scale: scale}
+}
+
+func (m *momentum) Step(path *geo.Path, forces []geo.Point, objective Objective) []geo.Point {
+	if len(m.corrections) != len(forces) {
+		m.corrections = make([]geo.Point, len(forces))
+	}
+
+	for i := range forces {
+		m.corrections[i].Scale(m.scale).Add(&forces[i])
+	}
+
+	return m.corrections
+}
+
+// nesterov is Nesterov accelerated gradient descent. It uses the reformulation where the
+// velocity update is applied twice so forces only need to be computed at the current path.
+type nesterov struct {
+	scale       float64
+	velocity    []geo.Point
+	corrections []geo.Point
+}
+
+// NewNesterov creates a Nesterov accelerated gradient descent optimizer
+// using the given momentum scale.
+func NewNesterov(scale float64) Optimizer {
+	return &nesterov{scale: scale}
+}
+
+func (n *nesterov) Step(path *geo.Path, forces []geo.Point, objective Objective) []geo.Point {
+	if len(n.velocity) != len(forces) {
+		n.velocity = make([]geo.Point, len(forces))
+		n.corrections = make([]geo.Point, len(forces))
+	}
+
+	for i := range forces {
+		n.velocity[i].Scale(n.scale).Add(&forces[i])
+		n.corrections[i] = n.velocity[i]
+		n.corrections[i].Scale(n.scale).Add(&forces[i])
+	}
+
+	return n.corrections
+}
+
+// adam is the Adam optimizer, corrections are based on running averages of
+// the forces and their squares so step sizes are similar for all the vertices.
+type adam struct {
+	rate         float64
+	beta1, beta2 float64
+	epsilon      float64
+
+	step        int
+	mean        []geo.Point
+	variance    []geo.Point
+	corrections []geo.Point
+}
+
+// NewAdam creates an Adam optimizer. The learning rate is the maximum correction,
+// in projected units, per loop.
+func NewAdam(learningRate float64) Optimizer {
+	return &adam{
+		rate:    learningRate,
+		beta1:   0.9,
+		beta2:   0.999,
+		epsilon: 1e-8,
+	}
+}
+
+func (a *adam) Step(path *geo.Path, forces []geo.Point, objective Objective) []geo.Point {
+	if len(a.mean) != len(forces) {
+		a.step = 0
+		a.mean = make([]geo.Point, len(forces))
+		a.variance = make([]geo.Point, len(forces))
+		a.corrections = make([]geo.Point, len(forces))
+	}
+
+	a.step++
+	correction1 := 1 - math.Pow(a.beta1, float64(a.step))
+	correction2 := 1 - math.Pow(a.beta2, float64(a.step))
+
+	for i := range forces {
+		for k := 0; k < 2; k++ {
+			f := forces[i][k]
+			a.mean[i][k] = a.beta1*a.mean[i][k] + (1-a.beta1)*f
+			a.variance[i][k] = a.beta2*a.variance[i][k] + (1-a.beta2)*f*f
+
+			m := a.mean[i][k] / correction1
+			v := a.variance[i][k] / correction2
+			a.corrections[i][k] = a.rate * m / (math.Sqrt(v) + a.epsilon)
+		}
+	}
+
+	return a.corrections
+}
+
+// lbfgs is limited memory BFGS on the whole path with a backtracking line search
+// on the path energy. The forces are used as the negative gradient of the energy.
+type lbfgs struct {
+	memory int
+
+	previousPath     []geo.Point
+	previousGradient []geo.Point
+	s, y             [][]geo.Point // position and gradient changes, most recent last
+}
+
+// NewLBFGS creates a limited memory BFGS optimizer keeping the given number of
+// previous steps. Every step does a backtracking line search on the path energy.
+func NewLBFGS(memory int) Optimizer {
+	if memory < 1 {
+		memory = 1
+	}
+
+	return &lbfgs{memory: memory}
+}
+
+func (l *lbfgs) Step(path *geo.Path, forces []geo.Point, objective Objective) []geo.Point {
+	n := len(forces)
+
+	// the gradient of the energy, endpoints are fixed so they are left out
+	gradient := make([]geo.Point, n)
+	for i := 1; i < n-1; i++ {
+		gradient[i] = forces[i]
+		gradient[i].Scale(-1)
+	}
+
+	current := make([]geo.Point, n)
+	for i := 1; i < n-1; i++ {
+		current[i] = *path.GetAt(i)
+	}
+
+	if len(l.previousPath) != n {
+		l.s, l.y = nil, nil
+	} else {
+		s := subtractPoints(current, l.previousPath)
+		y := subtractPoints(gradient, l.previousGradient)
+
+		if dotPoints(s, y) > 1e-12 {
+			l.s = append(l.s, s)
+			l.y = append(l.y, y)
+
+			if len(l.s) > l.memory {
+				l.s, l.y = l.s[1:], l.y[1:]
+			}
+		}
+	}
+
+	l.previousPath = current
+	l.previousGradient = gradient
+
+	// two loop recursion for the direction
+	direction := make([]geo.Point, n)
+	copy(direction, gradient)
+
+	alphas := make([]float64, len(l.s))
+	for k := len(l.s) - 1; k >= 0; k-- {
+		alphas[k] = dotPoints(l.s[k], direction) / dotPoints(l.y[k], l.s[k])
+		addScaledPoints(direction, l.y[k], -alphas[k])
+	}
+
+	if k := len(l.s) - 1; k >= 0 {
+		gamma := dotPoints(l.s[k], l.y[k]) / dotPoints(l.y[k], l.y[k])
+		for i := range direction {
+			direction[i].Scale(gamma)
+		}
+	}
+
+	for k := range l.s {
+		beta := dotPoints(l.y[k], direction) / dotPoints(l.y[k], l.s[k])
+		addScaledPoints(direction, l.s[k], alphas[k]-beta)
+	}
+
+	for i := range direction {
+		direction[i].Scale(-1)
+	}
+
+	// not a descent direction, restart from the gradient
+	slope := dotPoints(gradient, direction)
+	if slope >= 0 {
+		l.s, l.y = nil, nil
+		for i := range direction {
+			direction[i] = forces[i]
+		}
+		slope = dotPoints(gradient, direction)
+	}
+
+	// backtracking line search with the Armijo condition
+	energy := objective.Energy(path)
+	trial := path.Clone()
+
+	step := 1.0
+	for i := 0; i < 20; i++ {
+		for j := 1; j < n-1; j++ {
+			trial.SetAt(j, path.GetAt(j).Clone().Add(direction[j].Clone().Scale(step)))
+		}
+
+		if objective.Energy(trial) <= energy+1e-4*step*slope {
+			break
+		}
+
+		step /= 2
+	}
+
+	for i := range direction {
+		direction[i].Scale(step)
+	}
+
+	return direction
+}
+
+func subtractPoints(a, b []geo.Point) []geo.Point {
+	result := make([]geo.Point, len(a))
+	for i := range a {
+		result[i] = a[i]
+		result[i].Subtract(&b[i])
+	}
+
+	return result
+}
+
+func dotPoints(a, b []geo.Point) float64 {
+	sum := 0.0
+	for i := range a {
+		sum += a[i].Dot(&b[i])
+	}
+
+	return sum
+}
+
+func addScaledPoints(a, b []geo.Point, scale float64) {
+	for i := range a {
+		a[i].Add(b[i].Clone().Scale(scale))
+	}
+}
@@ -0,0 +1,266 @@
+package slide
+
+import (
+	"math"
+	"reflect"
+
+	"github.com/paulmach/go.geo"
+)
+
+const (
+	projectionEarthRadius = 6378137.0 // meters, same as EPSG:3857
+	utmScale              = 0.9996    // scale on the central meridian of a UTM zone
+)
+
+// A Projection converts between lat/lng (EPSG:4326) and the planar space the slide is done in.
+// Projections should be conformal, or close to it, so the scale is the same in all directions.
+// Implementations should be comparable, see ProjectedSurfacer.
+type Projection interface {
+	// Project and Inverse convert the point in place.
+	Project(point *geo.Point)
+	Inverse(point *geo.Point)
+
+	// ScaleFactor is the projected units per meter at the projected point.
+	ScaleFactor(point *geo.Point) float64
+}
+
+// A ProjectedSurfacer is a Surfacer defined in a projection other than EPSG:3857.
+// If the projection of the surfacer is not the projection of the slide,
+// points and gradients are converted between the two.
+type ProjectedSurfacer interface {
+	Surfacer
+	Projection() Projection
+}
+
+// WebMercator is the EPSG:3857 projection, the default. The scale changes with latitude
+// so it is not the best for long north-south paths or high latitudes, see AutoUTM.
+var WebMercator Projection = webMercator{}
+
+type webMercator struct{}
+
+func (webMercator) Project(point *geo.Point) {
+	geo.Mercator.Project(point)
+}
+
+func (webMercator) Inverse(point *geo.Point) {
+	geo.Mercator.Inverse(point)
+}
+
+func (webMercator) ScaleFactor(point *geo.Point) float64 {
+	return math.Cosh(point.Y() / projectionEarthRadius)
+}
+
+// utm is a spherical transverse mercator projection on the central meridian of a UTM zone.
+// There is no false easting or northing, they do not change the slide.
+type utm struct {
+	center float64 // central meridian in radians
+}
+
+// NewUTM creates the projection for the UTM zone, from 1 to 60.
+// The scale is within 0.1% of true for about 3 degrees of longitude either side
+// of the central meridian, all latitudes are supported.
+func NewUTM(zone int) Projection {
+	zone = maxInt(1, minInt(zone, 60))
+	return utm{center: float64(6*zone-183) * math.Pi / 180}
+}
+
+// UTMZone returns the UTM zone, from 1 to 60, containing the longitude.
+func UTMZone(lng float64) int {
+	return maxInt(1, minInt(int(math.Floor((lng+180)/6))+1, 60))
+}
+
+// AutoUTM returns the UTM projection for the zone at the center of the bound of the geometry.
+// Useful for long north-south paths and high latitudes where the scale of EPSG:3857 varies.
+func AutoUTM(geometry []*geo.Path) Projection {
+	if len(geometry) == 0 {
+		return WebMercator
+	}
+
+	bound := geometry[0].Bound()
+	for i := 1; i < len(geometry); i++ {
+		bound.Union(geometry[i].Bound())
+	}
+
+	return NewUTM(UTMZone(bound.Center().Lng()))
+}
+
+func (u utm) Project(point *geo.Point) {
+	lambda := point.Lng()*math.Pi/180 - u.center
+	phi := point.Lat() * math.Pi / 180
+
+	b := math.Cos(phi) * math.Sin(lambda)
+
+	point.SetX(projectionEarthRadius * utmScale * math.Atanh(b))
+	point.SetY(projectionEarthRadius * utmScale * math.Atan2(math.Tan(phi), math.Cos(lambda)))
+}
+
+func (u utm) Inverse(point *geo.Point) {
+	x := point.X() / (projectionEarthRadius * utmScale)
+	d := point.Y() / (projectionEarthRadius * utmScale)
+
+	phi := math.Asin(math.Sin(d) / math.Cosh(x))
+	lambda := u.center + math.Atan2(math.Sinh(x), math.Cos(d))
+
+	point.SetX(lambda * 180 / math.Pi)
+	point.SetY(phi * 180 / math.Pi)
+}
+
+func (u utm) ScaleFactor(point *geo.Point) float64 {
+	return utmScale * math.Cosh(point.X()/(projectionEarthRadius*utmScale))
+}
+
+// customProjection is a caller supplied transform.
+type customProjection struct {
+	projection  geo.Projection
+	scaleFactor func(point *geo.Point) float64
+}
+
+// NewProjection creates a projection from a transform, such as one from a
+// projection library. The scale factor is the projected units per meter at the projected point.
+// If nil it is estimated by projecting a small north-south offset.
+func NewProjection(projection geo.Projection, scaleFactor func(point *geo.Point) float64) Projection {
+	return &customProjection{
+		projection:  projection,
+		scaleFactor: scaleFactor,
+	}
+}
+
+func (c *customProjection) Project(point *geo.Point) {
+	c.projection.Project(point)
+}
+
+func (c *customProjection) Inverse(point *geo.Point) {
+	c.projection.Inverse(point)
+}
+
+func (c *customProjection) ScaleFactor(point *geo.Point) float64 {
+	if c.scaleFactor != nil {
+		return c.scaleFactor(point)
+	}
+
+	const offset = 1e-5 // degrees, about a meter
+
+	p := point.Clone()
+	c.projection.Inverse(p)
+	p.SetY(p.Y() + offset)
+	c.projection.Project(p)
+
+	return p.DistanceFrom(point) / (offset * math.Pi / 180 * projectionEarthRadius)
+}
+
+// projection returns the projection to slide in, defaults to WebMercator.
+func (s *Slide) projection() Projection {
+	if s.Projection != nil {
+		return s.Projection
+	}
+
+	return WebMercator
+}
+
+// withProjection returns a copy of the slide using the projection,
+// with the Surfacer converted to the projection if needed.
+func (s *Slide) withProjection(projection Projection) *Slide {
+	projected := *s
+	projected.Projection = projection
+	projected.Surfacer = reproject(s.Surfacer, projection)
+
+	return &projected
+}
+
+// reproject wraps the surfacer so it accepts points in the projection.
+func reproject(surfacer Surfacer, projection Projection) Surfacer {
+	native := WebMercator
+	if p, ok := surfacer.(ProjectedSurfacer); ok {
+		native = p.Projection()
+	}
+
+	if sameProjection(native, projection) {
+		return surfacer
+	}
+
+	r := &reprojectedSurfacer{
+		Surfacer: surfacer,
+		from:     projection,
+		to:       native,
+	}
+
+	if smooth, ok := surfacer.(SmoothValuer); ok {
+		return &smoothReprojectedSurfacer{reprojectedSurfacer: r, smooth: smooth}
+	}
+
+	return r
+}
+
+// sameProjection compares the projections, projections that are not comparable are never the same.
+func sameProjection(a, b Projection) bool {
+	if !reflect.TypeOf(a).Comparable() || !reflect.TypeOf(b).Comparable() {
+		return false
+	}
+
+	return a == b
+}
+
+// reprojectedSurfacer converts points from the slide projection to the surfacer projection.
+type reprojectedSurfacer struct {
+	Surfacer
+	from, to Projection
+}
+
+func (r *reprojectedSurfacer) Projection() Projection {
+	return r.from
+}
+
+func (r *reprojectedSurfacer) convert(point *geo.Point) *geo.Point {
+	p := point.Clone()
+	r.from.Inverse(p)
+	r.to.Project(p)
+
+	return p
+}
+
+func (r *reprojectedSurfacer) ValueAt(point *geo.Point) float64 {
+	return r.Surfacer.ValueAt(r.convert(point))
+}
+
+// GradientAt converts the gradient using the derivative of the conversion,
+// estimated using unit offsets in the slide projection.
+func (r *reprojectedSurfacer) GradientAt(point *geo.Point) *geo.Point {
+	p := r.convert(point)
+	gradient := r.Surfacer.GradientAt(p)
+
+	dx := r.convert(point.Clone().Add(geo.NewPoint(1, 0))).Subtract(p)
+	dy := r.convert(point.Clone().Add(geo.NewPoint(0, 1))).Subtract(p)
+
+	return geo.NewPoint(gradient.Dot(dx), gradient.Dot(dy))
+}
+
+type smoothReprojectedSurfacer struct {
+	*reprojectedSurfacer
+	smooth SmoothValuer
+}
+
+func (r *smoothReprojectedSurfacer) SmoothValueAt(point *geo.Point) float64 {
+	return r.smooth.SmoothValueAt(r.convert(point))
+}
+
+// metricLength is the length of the projected path in meters,
+// using the scale factor at the middle of every segment.
+func metricLength(path *geo.Path, projection Projection) float64 {
+	length := 0.0
+	for i := 1; i < path.Length(); i++ {
+		a, b := path.GetAt(i-1), path.GetAt(i)
+		middle := a.Clone().Add(b).Scale(0.5)
+
+		length += a.DistanceFrom(b) / projection.ScaleFactor(middle)
+	}
+
+	return length
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
@@ -32,14 +32,20 @@ func NewTrim(reducer geo.GeoReducer) *Trim {
 // GeoReduce will first trim any points within `EndPointRadius` of the endpoints.
 // Then it will run the path through the Parent reducer.
 func (t *Trim) GeoReduce(path *geo.Path) *geo.Path {
+	return t.GeoReduceEnds(path, true, true)
+}
+
+// GeoReduceEnds is GeoReduce but only trims the first and/or last endpoint.
+// This is for parts of a longer path, where the other ends are not real endpoints.
+func (t *Trim) GeoReduceEnds(path *geo.Path, first, last bool) *geo.Path {
 	parts := int(path.GeoDistance() / t.ResampleInterval)
 	path = path.Clone().Resample(parts)
 
-	for path.Length() > 2 && path.GetAt(0).GeoDistanceFrom(path.GetAt(1)) < t.EndPointRadius {
+	for first && path.Length() > 2 && path.GetAt(0).GeoDistanceFrom(path.GetAt(1)) < t.EndPointRadius {
 		path.RemoveAt(1)
 	}
 
-	for path.Length() > 2 && path.GetAt(path.Length()-1).GeoDistanceFrom(path.GetAt(path.Length()-2)) < t.EndPointRadius {
+	for last && path.Length() > 2 && path.GetAt(path.Length()-1).GeoDistanceFrom(path.GetAt(path.Length()-2)) < t.EndPointRadius {
 		path.RemoveAt(path.Length() - 2)
 	}
 
@@ -1,82 +1,240 @@
 package slide
 
 import (
+	"context"
 	"math"
+	"math/rand"
 	"sync"
+	"time"
 
 	"github.com/paulmach/go.geo"
 )
 
 const (
 	scoreSmoothingFactor = 0.2 // (0, 1.0), higher is more smoothing
+	minChunkSize         = 64  // vertices, smaller paths are not split between workers
 )
 
+// workerPayload is a contiguous chunk, [Start, End), of the vertices of a path.
 type workerPayload struct {
-	Path        *geo.Path
-	NewPath     *geo.Path
-	Index       int
-	Corrections []geo.Point
-	WG          *sync.WaitGroup
+	Path       *geo.Path
+	Start, End int
+	Forces     []geo.Point
+	Terms      []EnergyTerm
+	Env        *Environment
+	WG         *sync.WaitGroup
 }
 
-// refine does the iterative refinement.
-func (s *Slide) refine() (*Result, error) {
+// pathState is the refinement state of one of the paths being slid.
+type pathState struct {
+	Path      *geo.Path
+	Spare     *geo.Path // buffer for the next path, swapped with Path every loop
+	Original  *geo.Path // before resampling, for the tether and MaxDisplacement
+	Env       *Environment
+	Separated []int // segments to keep apart from, see Environment.Others
+	Forces    []geo.Point
+	Optimizer Optimizer
+
+	Score     float64 // exponentially smoothed path score
+	PathScore float64
+	Delta     float64
+	Converged bool
+
+	// Last is the state after the previous loop, its energy is reused by the next.
+	// It is one of the loop states, the other is the buffer for the next loop.
+	Last       *LoopState
+	loopStates [2]LoopState
+}
+
+// nextLoopState returns the loop state buffer that is not Last.
+func (state *pathState) nextLoopState() *LoopState {
+	if state.Last == &state.loopStates[0] {
+		return &state.loopStates[1]
+	}
+
+	return &state.loopStates[0]
+}
+
+// refine does the iterative refinement. All the paths are refined together
+// using the same worker pool but each path will stop when it converges.
+// The paths are the segments of the network, the junctions are their shared endpoints and are moved as one vertex.
+// If the context is done the refinement stops and the current state is returned with the context error.
+// The random source is used for the annealing noise, see Slide.Temperature.
+// Intermediate geometries are saved to the samples, which are shared by all the stages.
+// The offset is the loops run by the earlier stages, the history, samples and progress
+// count the loops across the stages. LoopsCompleted is the number of loops run by this stage.
+func (s *Slide) refine(ctx context.Context, paths []*geo.Path, net *network, random *rand.Rand, samples *sampling, offset int) (*Result, error) {
 	var (
-		loop         int
-		delta        float64
-		currentScore float64
-		pathScore    float64
+		loop int
+		err  error
 	)
 
-	// currently only one line is supported. TODO: improve.
-	path := s.Geometry[0]
+	terms := s.terms()
+
+	states := make([]*pathState, len(paths))
+	for i, path := range paths {
+		states[i] = &pathState{
+			Path:     path,
+			Original: net.Originals[i],
+			Env: &Environment{
+				Surfacer:   s.Surfacer,
+				Projection: net.Projection,
+				Original:   net.Originals[i],
+			},
+			Separated: net.separated(i),
+			Forces:    make([]geo.Point, path.Length()),
+			Optimizer: s.newOptimizer(),
+		}
+	}
+
+	// optimizer state, such as momentum, does not carry over between stages
+	for _, junction := range net.Junctions {
+		junction.Optimizer = s.newOptimizer()
+	}
 
 	// start the workers
 	var workersWG sync.WaitGroup
 	payloads := make(chan workerPayload, 100)
 
-	workersWG.Add(s.Goroutines)
-	for i := 0; i < s.Goroutines; i++ {
+	goroutines := maxInt(s.Goroutines, 1)
+
+	workersWG.Add(goroutines)
+	for i := 0; i < goroutines; i++ {
 		go s.refineWorker(payloads, &workersWG)
 	}
 
-	intermediateGeometries := make([][]*geo.Path, 0, s.NumberIntermediateGeometries)
-	previousCorrections := make([]geo.Point, path.Length()) // used for momentum
+	var history History
+	last := -1 // the last completed loop
+
+	// junctions are computed from the current paths, then applied
+	// to the new paths, or in place for paths that have already converged.
+	// These are reused every loop.
+	currentPaths := make([]*geo.Path, len(states))
+	newPaths := make([]*geo.Path, len(states))
+	junctionCorrections := make([]geo.Point, len(net.Junctions))
+
+	convergence := s.convergence()
+	start := time.Now()
 
 	for loop = 0; loop < s.MaxLoops; loop++ {
-		newPath := path.Clone()
+		if err = ctx.Err(); err != nil {
+			break
+		}
 
 		var wait sync.WaitGroup
-		wait.Add(path.Length() - 2)
-
-		for j := 1; j < path.Length()-1; j++ {
-			payloads <- workerPayload{
-				Path:        path,
-				Corrections: previousCorrections,
-				NewPath:     newPath,
-				Index:       j,
-				WG:          &wait,
+
+		for _, state := range states {
+			if state.Converged {
+				continue
 			}
+
+			state.Env.Others = state.Env.Others[:0]
+			for _, j := range state.Separated {
+				state.Env.Others = append(state.Env.Others, states[j].Path)
+			}
+
+			sendChunks(payloads, state, terms, goroutines, &wait)
 		}
+
+		for i, state := range states {
+			currentPaths[i] = state.Path
+		}
+
+		for i, junction := range net.Junctions {
+			junctionCorrections[i] = s.junctionCorrection(net, terms, currentPaths, junction)
+		}
+
 		wait.Wait()
 
-		path = newPath // new becomes current
-		if loop < s.NumberIntermediateGeometries {
-			intermediateGeometries = append(intermediateGeometries, []*geo.Path{path})
+		temperature := s.temperature(loop)
+
+		for i, state := range states {
+			newPaths[i] = nil
+			if !state.Converged {
+				newPaths[i] = s.step(state, terms, net.Projection, temperature, random)
+			}
 		}
 
-		// check how we did
-		// First, compute the score taking the average surface value.
-		// Then exponentially smooth those values and keep looping until they don't change very much.
-		pathScore = averageSurfaceValue(s.Surfacer, path)
+		if s.PreserveTopology {
+			net.untangle(newPaths, currentPaths)
+		}
 
-		previousScore := currentScore
-		currentScore = scoreSmoothingFactor*previousScore + (1-scoreSmoothingFactor)*pathScore
+		for i, junction := range net.Junctions {
+			for _, end := range junction.Ends {
+				if newPaths[end.Segment] != nil {
+					end.point(newPaths).Add(&junctionCorrections[i])
+				} else {
+					end.point(currentPaths).Add(&junctionCorrections[i])
+				}
+			}
+		}
 
-		delta = math.Abs(currentScore - previousScore)
+		converged := true
+		for i, state := range states {
+			if state.Converged {
+				continue
+			}
+
+			previous := state.Path
+			state.Path = newPaths[i] // new becomes current
+			state.Spare = previous   // and the buffer for the next loop
+
+			// check how we did
+			// First, compute the score taking the average surface value.
+			// Then exponentially smooth those values and keep looping until they don't change very much.
+			state.PathScore = averageSurfaceValue(s.Surfacer, state.Path)
+
+			previousScore := state.Score
+			state.Score = scoreSmoothingFactor*previousScore + (1-scoreSmoothingFactor)*state.PathScore
+
+			state.Delta = math.Abs(state.Score - previousScore)
+
+			loopState := state.nextLoopState()
+			*loopState = LoopState{
+				Loop:        loop,
+				PathScore:   state.PathScore,
+				Score:       state.Score,
+				Delta:       state.Delta,
+				MaxMovement: maxMovement(state.Path, previous, net.Projection),
+				Elapsed:     s.since(start),
+
+				terms:    terms,
+				env:      state.Env,
+				path:     state.Path,
+				previous: previous,
+			}
 
-		// break condition
-		if loop >= s.MinLoops && delta < s.ThresholdEpsilon {
+			if state.Last != nil && state.Last.hasEnergy {
+				loopState.previousEnergy, loopState.hasPreviousEnergy = state.Last.energy, true
+			}
+			state.Last = loopState
+
+			// break condition for this path
+			if convergence.Converged(loopState) {
+				state.Converged = true
+			} else {
+				converged = false
+			}
+
+			if !state.Converged && s.AdaptiveInterval > 0 && (loop+1)%s.AdaptiveInterval == 0 {
+				s.reparameterize(state, net.Projection)
+			}
+		}
+
+		last = loop
+		samples.sample(states, offset+loop, false)
+
+		if s.RecordHistory {
+			history = append(history, record(offset+loop, states, terms))
+		}
+
+		if s.OnLoop != nil {
+			if err = s.OnLoop(net.progress(offset+loop, states)); err != nil {
+				break
+			}
+		}
+
+		if converged {
 			break
 		}
 	}
@@ -85,66 +243,169 @@ func (s *Slide) refine() (*Result, error) {
 	close(payloads)
 	workersWG.Wait()
 
-	// simplify path
-	path = path.Clone() // path is pointer, so may be in intermediateGeometries above
+	// a stopped refinement is the end of the slide, even if it is not the last stage.
+	if last >= 0 && (samples.Final || err != nil) {
+		samples.sample(states, offset+last, true)
+	}
+
+	// the refinement stops once the slowest path converges.
+	result := &Result{
+		CorrectedGeometry: make([]*geo.Path, len(states)),
+		LoopsCompleted:    last + 1,
+		History:           history,
+	}
+
+	for i, state := range states {
+		result.CorrectedGeometry[i] = state.Path.Clone()
+
+		result.LastLoopError = math.Max(result.LastLoopError, state.Delta)
+		result.LastLoopScore += state.PathScore / float64(len(states))
+	}
 
-	return &Result{
-		CorrectedGeometry:    []*geo.Path{path},
-		IntermediateGeometry: intermediateGeometries,
-		LoopsCompleted:       loop,
-		LastLoopError:        delta,
-		LastLoopScore:        pathScore,
-	}, nil
+	return result, err
+}
+
+// sendChunks splits the interior vertices of the path into one contiguous chunk per worker
+// and sends them to compute the forces. Small paths are not split.
+func sendChunks(payloads chan<- workerPayload, state *pathState, terms []EnergyTerm, goroutines int, wait *sync.WaitGroup) {
+	path := state.Path
+	interior := path.Length() - 2
+
+	chunks := minInt(goroutines, (interior+minChunkSize-1)/minChunkSize)
+	size := (interior + chunks - 1) / maxInt(chunks, 1)
+
+	for j := 1; j < path.Length()-1; j += size {
+		wait.Add(1)
+		payloads <- workerPayload{
+			Path:   path,
+			Start:  j,
+			End:    minInt(j+size, path.Length()-1),
+			Forces: state.Forces,
+			Terms:  terms,
+			Env:    state.Env,
+			WG:     wait,
+		}
+	}
 }
 
 func (s *Slide) refineWorker(payloads <-chan workerPayload, finish *sync.WaitGroup) {
 	defer finish.Done()
 
 	for load := range payloads {
-		gradient := s.GradientContributionFunc(s.Surfacer, load.Path.GetAt(load.Index), s.GradientScale)
-		distance := s.DistanceContributionFunc(load.Path, load.Index, s.DistanceScale)
-		angle := s.AngleContributionFunc(load.Path, load.Index, s.AngleScale)
+		for j := load.Start; j < load.End; j++ {
+			load.Forces[j] = force(load.Terms, load.Path, j, load.Env)
+		}
+		load.WG.Done()
+	}
+}
 
-		// put them together
-		correction := geo.NewPoint(0, 0).Add(distance).Add(angle).Add(gradient)
-		correction.Add(load.Corrections[load.Index].Scale(s.MomentumScale))
+// step uses the optimizer to turn the forces on the path into corrections
+// and returns the new, corrected, path. Vertices are kept within MaxDisplacement
+// of the original path, the projection scale converts it to projected units.
+// The new path is the spare buffer of the state, it is not a new allocation.
+// Random noise with a standard deviation of the temperature, in meters, is added to the corrections.
+func (s *Slide) step(state *pathState, terms []EnergyTerm, projection Projection, temperature float64, random *rand.Rand) *geo.Path {
+	path := state.Path
+	corrections := state.Optimizer.Step(path, state.Forces, objective{terms: terms, env: state.Env})
+
+	if state.Spare == nil || state.Spare.Length() != path.Length() {
+		state.Spare = path.Clone()
+	} else {
+		copy(state.Spare.Points(), path.Points())
+	}
 
+	newPath := state.Spare
+	for j := 1; j < path.Length()-1; j++ {
+		correction := &corrections[j]
 		if s.DepthBasedReduction {
-			v := s.Surfacer.ValueAt(load.Path.GetAt(load.Index))
+			v := s.Surfacer.ValueAt(path.GetAt(j))
 			correction.Scale(math.Sqrt(1.0 - v))
 		}
 
-		load.NewPath.GetAt(load.Index).Add(correction)
-		load.Corrections[load.Index] = *correction
+		point := newPath.GetAt(j).Add(correction)
+		if temperature > 0 {
+			scale := temperature * projection.ScaleFactor(point)
+			point.SetX(point.X() + random.NormFloat64()*scale)
+			point.SetY(point.Y() + random.NormFloat64()*scale)
+		}
 
-		load.WG.Done()
+		if s.MaxDisplacement > 0 {
+			origin := closestOnPath(point, state.Original)
+			leash(point, origin, s.MaxDisplacement*projection.ScaleFactor(origin))
+		}
 	}
+
+	return newPath
 }
 
-func gradientContribution(surfacer Surfacer, point *geo.Point, scale float64) *geo.Point {
-	gradient := geo.NewPoint(0, 0)
+// temperature is the annealing temperature, in meters, for the loop.
+func (s *Slide) temperature(loop int) float64 {
+	if s.Temperature <= 0 {
+		return 0
+	}
+
+	return s.Temperature * math.Pow(s.Cooling, float64(loop))
+}
+
+// since is the time since start, always zero in Deterministic mode.
+func (s *Slide) since(start time.Time) time.Duration {
+	if s.Deterministic {
+		return 0
+	}
+
+	return time.Since(start)
+}
+
+// leash moves the point so it is within the radius of the origin.
+func leash(point, origin *geo.Point, radius float64) {
+	if d := point.DistanceFrom(origin); d > radius {
+		point.Subtract(origin).Scale(radius / d).Add(origin)
+	}
+}
+
+// newOptimizer creates the optimizer for a path, defaults to momentum using MomentumScale.
+func (s *Slide) newOptimizer() Optimizer {
+	if s.NewOptimizer != nil {
+		return s.NewOptimizer()
+	}
+
+	return NewMomentum(s.MomentumScale)
+}
+
+// gradientForce is gradientContribution without the allocation.
+func gradientForce(surfacer Surfacer, point *geo.Point, scale float64) geo.Point {
+	var gradient geo.Point
 	if scale != 0.0 {
-		gradient = surfacer.GradientAt(point)
+		gradient = *surfacer.GradientAt(point)
 		gradient.Scale(scale)
 	}
 
 	return gradient
 }
 
-func distanceContribution(path *geo.Path, index int, scale float64) *geo.Point {
-	distance := geo.NewPoint(0, 0)
+// distanceForce is distanceContribution without the allocation.
+func distanceForce(path *geo.Path, index int, scale float64) geo.Point {
+	var distance geo.Point
 	if scale != 0.0 {
-		v := path.GetAt(index).Clone().Subtract(path.GetAt(index - 1))
-		u := path.GetAt(index + 1).Clone().Subtract(path.GetAt(index - 1))
+		v := *path.GetAt(index)
+		v.Subtract(path.GetAt(index - 1))
+
+		u := *path.GetAt(index + 1)
+		u.Subtract(path.GetAt(index - 1))
 
-		dot := u.Dot(u)
+		dot := u.Dot(&u)
 		if dot != 0 {
 			// normal case
-			center := u.Clone().Scale(u.Dot(v) / dot).Add(path.GetAt(index - 1))
+			center := u
+			center.Scale(u.Dot(&v) / dot).Add(path.GetAt(index - 1))
 
-			m2 := path.GetAt(index + 1).Clone().Subtract(center)
-			m1 := path.GetAt(index - 1).Clone().Subtract(center)
-			distance = m1.Add(m2).Scale(scale)
+			m2 := *path.GetAt(index + 1)
+			m2.Subtract(&center)
+
+			m1 := *path.GetAt(index - 1)
+			m1.Subtract(&center)
+
+			distance = *m1.Add(&m2).Scale(scale)
 		} else {
 			// equal to zero if the points are the same
 			// good times with round off error
@@ -154,27 +415,46 @@ func distanceContribution(path *geo.Path, index int, scale float64) *geo.Point {
 	return distance
 }
 
-func angleContribution(path *geo.Path, index int, scale float64) *geo.Point {
-	angle := geo.NewPoint(0, 0)
-
+// angleForce is angleContribution without the allocation.
+func angleForce(path *geo.Path, index int, scale float64) geo.Point {
+	var angle geo.Point
 	if scale != 0.0 {
-		n1 := path.GetAt(index - 1).Clone().Subtract(path.GetAt(index))
-		n2 := path.GetAt(index + 1).Clone().Subtract(path.GetAt(index))
+		n1 := *path.GetAt(index - 1)
+		n1.Subtract(path.GetAt(index))
+
+		n2 := *path.GetAt(index + 1)
+		n2.Subtract(path.GetAt(index))
 
-		len1 := n1.DistanceFrom(geo.NewPoint(0, 0))
-		len2 := n2.DistanceFrom(geo.NewPoint(0, 0))
+		var origin geo.Point
+		len1 := n1.DistanceFrom(&origin)
+		len2 := n2.DistanceFrom(&origin)
 
 		n1.Normalize()
 		n2.Normalize()
 
 		// cbrt
-		factor := math.Cbrt(n1.Dot(n2)) + 1
-		angle = n1.Add(n2).Normalize().Scale(math.Min(len1, len2) * scale * factor)
+		factor := math.Cbrt(n1.Dot(&n2)) + 1
+		angle = *n1.Add(&n2).Normalize().Scale(math.Min(len1, len2) * scale * factor)
 	}
 
 	return angle
 }
 
+func gradientContribution(surfacer Surfacer, point *geo.Point, scale float64) *geo.Point {
+	gradient := gradientForce(surfacer, point, scale)
+	return &gradient
+}
+
+func distanceContribution(path *geo.Path, index int, scale float64) *geo.Point {
+	distance := distanceForce(path, index, scale)
+	return &distance
+}
+
+func angleContribution(path *geo.Path, index int, scale float64) *geo.Point {
+	angle := angleForce(path, index, scale)
+	return &angle
+}
+
 func averageSurfaceValue(surfacer Surfacer, path *geo.Path) float64 {
 	valueSum := 0.0
 	for i := 0; i < path.Length(); i++ {
@@ -183,3 +463,11 @@ func averageSurfaceValue(surfacer Surfacer, path *geo.Path) float64 {
 
 	return valueSum / float64(path.Length())
 }
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}
@@ -0,0 +1,278 @@
+package slide
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/paulmach/go.geo"
+)
+
+// benchSurfacer is a surface of parallel valleys, every 50 projected units along y.
+type benchSurfacer struct{}
+
+func (benchSurfacer) ValueAt(point *geo.Point) float64 {
+	return 0.5 + 0.5*math.Cos(2*math.Pi*point.Y()/50)
+}
+
+func (benchSurfacer) GradientAt(point *geo.Point) *geo.Point {
+	return geo.NewPoint(0, -0.5*2*math.Pi/50*math.Sin(2*math.Pi*point.Y()/50))
+}
+
+func (benchSurfacer) SuggestedOptions() *SuggestedOptions {
+	return &SuggestedOptions{
+		GradientScale: 0.5,
+		DistanceScale: 0.2,
+		AngleScale:    0.1,
+		MomentumScale: 0.7,
+	}
+}
+
+// benchNetwork returns the slide of a long path wiggling across the valleys, about 10 km
+// with a vertex every 5 units, split into three segments at two constrained vertices.
+// The segment paths are projected and the slide never converges before MaxLoops.
+func benchNetwork() (*Slide, *network, []*geo.Path) {
+	path := geo.NewPath()
+	for i := 0; i < 2000; i++ {
+		x := 5 * float64(i)
+		point := geo.NewPoint(x, 15*math.Sin(x/200))
+		WebMercator.Inverse(point)
+		path.Push(point)
+	}
+
+	s := New([]*geo.Path{path}, benchSurfacer{})
+	s.Constraints = []Constraint{
+		{Vertex: VertexRef{Path: 0, Index: 700}, Radius: 100},
+		{Vertex: VertexRef{Path: 0, Index: 1400}, Radius: 100},
+	}
+	s.Goroutines = runtime.GOMAXPROCS(0)
+	s.MaxLoops = 20
+	s.Convergence = ConvergenceFunc(func(*LoopState) bool { return false })
+	s = s.withProjection(s.projection())
+
+	net, err := s.buildNetwork()
+	if err != nil {
+		panic(err)
+	}
+
+	paths := net.segmentPaths()
+	for _, p := range paths {
+		p.Transform(s.Projection.Project)
+	}
+	net.setOrigins(paths, s.Projection)
+
+	return s, net, paths
+}
+
+func clonePaths(paths []*geo.Path) []*geo.Path {
+	clones := make([]*geo.Path, len(paths))
+	for i, p := range paths {
+		clones[i] = p.Clone()
+	}
+
+	return clones
+}
+
+// BenchmarkRefine is the refinement of the network, MaxLoops loops of all the segments.
+func BenchmarkRefine(b *testing.B) {
+	s, net, paths := benchNetwork()
+	random := rand.New(rand.NewSource(0))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		samples := &sampling{Sampler: FirstLoops(0), Final: true}
+		if _, err := s.refine(context.Background(), clonePaths(paths), net, random, samples, 0); err != nil {
+			b.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
+
+// BenchmarkRefinePerVertex is the baseline for BenchmarkRefine, see refinePerVertex.
+func BenchmarkRefinePerVertex(b *testing.B) {
+	s, net, paths := benchNetwork()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		refinePerVertex(s, clonePaths(paths), net)
+	}
+}
+
+// refinePerVertex is the previous refinement loop, without the intermediate geometries
+// and OnLoop. Every vertex is sent to the workers on its own, the forces of the terms are
+// returned as new points and the new paths, junction corrections and loop states are
+// allocated every loop.
+func refinePerVertex(s *Slide, paths []*geo.Path, net *network) {
+	type vertexPayload struct {
+		Path   *geo.Path
+		Index  int
+		Forces []geo.Point
+		Terms  []EnergyTerm
+		Env    *Environment
+		WG     *sync.WaitGroup
+	}
+
+	terms := s.terms()
+
+	states := make([]*pathState, len(paths))
+	for i, path := range paths {
+		states[i] = &pathState{
+			Path:     path,
+			Original: net.Originals[i],
+			Env: &Environment{
+				Surfacer:   s.Surfacer,
+				Projection: net.Projection,
+				Original:   net.Originals[i],
+			},
+			Separated: net.separated(i),
+			Forces:    make([]geo.Point, path.Length()),
+			Optimizer: s.newOptimizer(),
+		}
+	}
+
+	for _, junction := range net.Junctions {
+		junction.Optimizer = s.newOptimizer()
+	}
+
+	var workersWG sync.WaitGroup
+	payloads := make(chan vertexPayload, 100)
+
+	goroutines := maxInt(s.Goroutines, 1)
+
+	workersWG.Add(goroutines)
+	for i := 0; i < goroutines; i++ {
+		go func() {
+			defer workersWG.Done()
+
+			for load := range payloads {
+				sum := geo.NewPoint(0, 0)
+				for _, term := range load.Terms {
+					sum.Add(term.Force(load.Path, load.Index, load.Env))
+				}
+
+				load.Forces[load.Index] = *sum
+				load.WG.Done()
+			}
+		}()
+	}
+
+	convergence := s.convergence()
+	start := time.Now()
+
+	for loop := 0; loop < s.MaxLoops; loop++ {
+		var wait sync.WaitGroup
+
+		for _, state := range states {
+			if state.Converged {
+				continue
+			}
+
+			state.Env.Others = state.Env.Others[:0]
+			for _, j := range state.Separated {
+				state.Env.Others = append(state.Env.Others, states[j].Path)
+			}
+
+			path := state.Path
+
+			wait.Add(path.Length() - 2)
+			for j := 1; j < path.Length()-1; j++ {
+				payloads <- vertexPayload{
+					Path:   path,
+					Index:  j,
+					Forces: state.Forces,
+					Terms:  terms,
+					Env:    state.Env,
+					WG:     &wait,
+				}
+			}
+		}
+
+		currentPaths := make([]*geo.Path, len(states))
+		for i, state := range states {
+			currentPaths[i] = state.Path
+		}
+
+		junctionCorrections := make([]*geo.Point, len(net.Junctions))
+		for i, junction := range net.Junctions {
+			correction := s.junctionCorrection(net, terms, currentPaths, junction)
+			junctionCorrections[i] = &correction
+		}
+
+		wait.Wait()
+
+		newPaths := make([]*geo.Path, len(states))
+		for i, state := range states {
+			if state.Converged {
+				continue
+			}
+
+			corrections := state.Optimizer.Step(state.Path, state.Forces, objective{terms: terms, env: state.Env})
+
+			newPaths[i] = state.Path.Clone()
+			for j := 1; j < newPaths[i].Length()-1; j++ {
+				newPaths[i].GetAt(j).Add(&corrections[j])
+			}
+		}
+
+		for i, junction := range net.Junctions {
+			for _, end := range junction.Ends {
+				if newPaths[end.Segment] != nil {
+					end.point(newPaths).Add(junctionCorrections[i])
+				} else {
+					end.point(currentPaths).Add(junctionCorrections[i])
+				}
+			}
+		}
+
+		converged := true
+		for i, state := range states {
+			if state.Converged {
+				continue
+			}
+
+			previous := state.Path
+			state.Path = newPaths[i]
+
+			state.PathScore = averageSurfaceValue(s.Surfacer, state.Path)
+
+			previousScore := state.Score
+			state.Score = scoreSmoothingFactor*previousScore + (1-scoreSmoothingFactor)*state.PathScore
+			state.Delta = math.Abs(state.Score - previousScore)
+
+			loopState := &LoopState{
+				Loop:        loop,
+				PathScore:   state.PathScore,
+				Score:       state.Score,
+				Delta:       state.Delta,
+				MaxMovement: maxMovement(state.Path, previous, net.Projection),
+				Elapsed:     time.Since(start),
+
+				terms:    terms,
+				env:      state.Env,
+				path:     state.Path,
+				previous: previous,
+			}
+			state.Last = loopState
+
+			if convergence.Converged(loopState) {
+				state.Converged = true
+			} else {
+				converged = false
+			}
+		}
+
+		if converged {
+			break
+		}
+	}
+
+	close(payloads)
+	workersWG.Wait()
+}
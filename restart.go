@@ -0,0 +1,67 @@
+package slide
+
+import (
+	"math"
+	"math/rand"
+
+	"github.com/paulmach/go.geo"
+)
+
+// resampledEnergy is the total energy of the refined, projected, segment paths, each resampled
+// to the vertex count of its input segment at the ResampleInterval. The energy of the terms
+// grows with the number of vertices, this way it is the same for all the restarts.
+func (s *Slide) resampledEnergy(net *network, paths []*geo.Path) float64 {
+	resampled := make([]*geo.Path, len(paths))
+	for i, p := range paths {
+		count := int(math.Ceil(metricLength(net.Originals[i], net.Projection) / s.ResampleInterval))
+		resampled[i] = p.Clone().Resample(count + 3)
+	}
+
+	terms := s.terms()
+
+	sum := 0.0
+	for i, p := range resampled {
+		env := &Environment{
+			Surfacer:   s.Surfacer,
+			Projection: net.Projection,
+			Original:   net.Originals[i],
+		}
+
+		for _, j := range net.separated(i) {
+			env.Others = append(env.Others, resampled[j])
+		}
+
+		sum += energy(terms, p, env)
+	}
+
+	return sum
+}
+
+// perturb moves the interior vertices of the resampled, projected, paths sideways by
+// a random smooth bump, one to three half sine waves of up to amplitude meters.
+// The bump is zero at the endpoints so junctions and constrained vertices do not move.
+func perturb(paths []*geo.Path, projection Projection, amplitude float64, random *rand.Rand) {
+	for _, path := range paths {
+		n := path.Length()
+		if n < 3 {
+			continue
+		}
+
+		offset := (2*random.Float64() - 1) * amplitude
+		waves := float64(1 + random.Intn(3))
+
+		original := path.Clone()
+		for j := 1; j < n-1; j++ {
+			tangent := original.GetAt(j + 1).Clone().Subtract(original.GetAt(j - 1))
+			if tangent.Dot(tangent) == 0 {
+				continue
+			}
+			tangent.Normalize()
+
+			point := path.GetAt(j)
+			d := offset * math.Sin(math.Pi*waves*float64(j)/float64(n-1)) * projection.ScaleFactor(point)
+
+			point.Add(geo.NewPoint(-tangent.Y(), tangent.X()).Scale(d))
+		}
+	}
+}
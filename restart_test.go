@@ -0,0 +1,41 @@
+package slide
+
+import (
+	"math"
+	"testing"
+
+	"github.com/paulmach/go.geo"
+)
+
+func TestResampledEnergy(t *testing.T) {
+	input := geo.NewPath()
+	input.Push(geo.NewPoint(-122.0, 37.0))
+	input.Push(geo.NewPoint(-121.99, 37.0005))
+
+	s := New([]*geo.Path{input}, benchSurfacer{})
+	s = s.withProjection(s.projection())
+
+	net, err := s.buildNetwork()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	paths := net.segmentPaths()
+	paths[0].Transform(s.Projection.Project)
+	net.setOrigins(paths, s.Projection)
+
+	// the same refined geometry with very different vertex counts has the same energy.
+	sparse := s.resampledEnergy(net, []*geo.Path{paths[0].Clone().Resample(20)})
+	dense := s.resampledEnergy(net, []*geo.Path{paths[0].Clone().Resample(1000)})
+
+	if math.Abs(sparse-dense) > 1e-6*math.Abs(dense) {
+		t.Errorf("energy depends on the vertices: %v != %v", sparse, dense)
+	}
+
+	// the energy of the terms alone depends on the vertex count.
+	terms := s.terms()
+	env := &Environment{Surfacer: s.Surfacer, Projection: s.Projection}
+	if a, b := energy(terms, paths[0].Clone().Resample(20), env), energy(terms, paths[0].Clone().Resample(1000), env); a == b {
+		t.Errorf("expected the raw energy to depend on the vertices, got %v for both", a)
+	}
+}
@@ -0,0 +1,43 @@
+package slide
+
+import (
+	"github.com/paulmach/go.geo"
+	geo_reducers "github.com/paulmach/go.geo/reducers"
+)
+
+// NewRings creates a new Slide structure, with the default parameters, that will
+// slide the paths as closed rings. Rings have no fixed endpoints, the first and last
+// vertex are moved as one. Polygons with holes can be slid by passing the outer ring
+// and the holes, the corrected rings will be closed and in the same order.
+// Trimming the endpoints does not make sense for rings so the GeoReducer is
+// only Douglas-Peucker.
+func NewRings(rings []*geo.Path, surfacer Surfacer) *Slide {
+	s := New(rings, surfacer)
+	s.GeoReducer = geo_reducers.NewDouglasPeucker(1.0)
+	s.Closed = true
+
+	return s
+}
+
+// closeRings returns the paths with the first point added to the end,
+// if not already there. Closed paths are not copied.
+func closeRings(paths []*geo.Path) []*geo.Path {
+	closed := make([]*geo.Path, len(paths))
+	for i, p := range paths {
+		closed[i] = p
+		if !p.GetAt(0).Equals(p.GetAt(p.Length() - 1)) {
+			closed[i] = p.Clone().Push(p.GetAt(0))
+		}
+	}
+
+	return closed
+}
+
+// ringLength returns the number of distinct vertices in the ring.
+func ringLength(ring *geo.Path) int {
+	if ring.GetAt(0).Equals(ring.GetAt(ring.Length() - 1)) {
+		return ring.Length() - 1
+	}
+
+	return ring.Length()
+}
@@ -0,0 +1,49 @@
+package slide
+
+import (
+	"testing"
+
+	"github.com/paulmach/go.geo"
+)
+
+func TestNewRingsClosed(t *testing.T) {
+	// an open outer ring and a closed hole.
+	outer := geo.NewPath()
+	outer.Push(geo.NewPoint(-122.0, 37.0))
+	outer.Push(geo.NewPoint(-121.99, 37.0002))
+	outer.Push(geo.NewPoint(-121.99, 37.01))
+	outer.Push(geo.NewPoint(-122.0, 37.0098))
+
+	hole := geo.NewPath()
+	hole.Push(geo.NewPoint(-121.997, 37.003))
+	hole.Push(geo.NewPoint(-121.993, 37.003))
+	hole.Push(geo.NewPoint(-121.993, 37.007))
+	hole.Push(geo.NewPoint(-121.997, 37.007))
+	hole.Push(geo.NewPoint(-121.997, 37.003))
+
+	result, err := NewRings([]*geo.Path{outer, hole}, benchSurfacer{}).Do()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(result.CorrectedGeometry) != 2 {
+		t.Fatalf("expected 2 rings, got %d", len(result.CorrectedGeometry))
+	}
+
+	for i, ring := range result.CorrectedGeometry {
+		if ring.Length() < 4 {
+			t.Errorf("ring %d: expected at least 4 points, got %d", i, ring.Length())
+			continue
+		}
+
+		if first, last := *ring.GetAt(0), *ring.GetAt(ring.Length() - 1); first != last {
+			t.Errorf("ring %d: not closed, %v != %v", i, first, last)
+		}
+	}
+
+	// the rings are in the same order, the hole is inside the outer ring.
+	bound := result.CorrectedGeometry[1].Bound()
+	if !result.CorrectedGeometry[0].Bound().Contains(bound.Center()) {
+		t.Errorf("expected the hole inside the outer ring")
+	}
+}
@@ -0,0 +1,191 @@
+package slide
+
+import (
+	"github.com/paulmach/go.geo"
+)
+
+// A Sampler chooses the loops saved as intermediate geometries, see Slide.Sampler.
+// Samplers should not keep state, the same one can be used by many slides.
+type Sampler interface {
+	// Sample returns if the state after the loop should be saved. It is called after
+	// every loop and once more, with final set, for the last loop of the refinement.
+	Sample(loop int, final bool) bool
+
+	// Keep returns if a previously saved loop should still be kept, it is called after
+	// every new sample so samplers can thin out earlier samples.
+	Keep(saved, loop int) bool
+}
+
+// An Intermediate is the loop number and score of an intermediate geometry.
+// The score is the average surface value of the paths, like LastLoopScore.
+type Intermediate struct {
+	Loop  int
+	Score float64
+}
+
+// FirstLoops saves the first n loops. This is the default using NumberIntermediateGeometries.
+func FirstLoops(n int) Sampler {
+	return firstLoops(n)
+}
+
+type firstLoops int
+
+func (n firstLoops) Sample(loop int, final bool) bool {
+	return !final && loop < int(n)
+}
+
+func (n firstLoops) Keep(saved, loop int) bool {
+	return true
+}
+
+// EveryKth saves every kth loop, starting with the first, and the last loop.
+func EveryKth(k int) Sampler {
+	return everyKth(maxInt(k, 1))
+}
+
+type everyKth int
+
+func (k everyKth) Sample(loop int, final bool) bool {
+	return final || loop%int(k) == 0
+}
+
+func (k everyKth) Keep(saved, loop int) bool {
+	return true
+}
+
+// Logarithmic saves the loops at powers of the base, so the start where the
+// geometry changes the most is sampled more. For example, a base of 2 saves
+// loops 0, 1, 3, 7, 15, ... The last loop is always saved. The base must be greater than 1.
+func Logarithmic(base float64) Sampler {
+	if base <= 1 {
+		base = 2
+	}
+
+	return logarithmic(base)
+}
+
+type logarithmic float64
+
+func (base logarithmic) Sample(loop int, final bool) bool {
+	if final {
+		return true
+	}
+
+	for v := 1.0; int(v) <= loop+1; v *= float64(base) {
+		if int(v) == loop+1 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (base logarithmic) Keep(saved, loop int) bool {
+	return true
+}
+
+// EvenlySpaced saves up to n loops evenly spaced across the whole refinement,
+// including the last. The number of loops is not known in advance, so the spacing doubles
+// as the refinement goes on and every other sample is dropped. At least n/2 loops are saved.
+func EvenlySpaced(n int) Sampler {
+	return evenlySpaced(n)
+}
+
+type evenlySpaced int
+
+// stride is the spacing at the loop, the smallest power of 2 so that the samples so far,
+// the multiples of the stride, plus the loop itself if it is the last, are at most n.
+func (n evenlySpaced) stride(loop int) int {
+	stride := 1
+	for {
+		count := loop/stride + 1
+		if loop%stride != 0 {
+			count++
+		}
+
+		if count <= int(n) {
+			return stride
+		}
+
+		stride *= 2
+	}
+}
+
+func (n evenlySpaced) Sample(loop int, final bool) bool {
+	if final {
+		return true
+	}
+
+	if n <= 1 {
+		return false
+	}
+
+	return loop%n.stride(loop) == 0
+}
+
+func (n evenlySpaced) Keep(saved, loop int) bool {
+	if n <= 1 {
+		return false
+	}
+
+	return saved%n.stride(loop) == 0
+}
+
+// sampler returns the sampler to use, defaults to FirstLoops(NumberIntermediateGeometries).
+func (s *Slide) sampler() Sampler {
+	if s.Sampler != nil {
+		return s.Sampler
+	}
+
+	return FirstLoops(s.NumberIntermediateGeometries)
+}
+
+// intermediate is a saved intermediate geometry.
+type intermediate struct {
+	Intermediate
+	Geometry []*geo.Path
+}
+
+// sampling is the intermediate geometries of a slide. The loops are counted across
+// all the stages so the sampler sees the slide as one run.
+type sampling struct {
+	Sampler       Sampler
+	Intermediates []intermediate
+	Final         bool // the current stage is the last
+}
+
+// sample saves the current paths if the sampler wants the loop, counted across the stages.
+func (s *sampling) sample(states []*pathState, loop int, final bool) {
+	s.Intermediates = sample(s.Sampler, s.Intermediates, states, loop, final)
+}
+
+// sample saves the current paths if the sampler wants the loop
+// and drops the earlier samples it no longer needs.
+func sample(sampler Sampler, intermediates []intermediate, states []*pathState, loop int, final bool) []intermediate {
+	if !sampler.Sample(loop, final) {
+		return intermediates
+	}
+
+	if n := len(intermediates); n > 0 && intermediates[n-1].Loop == loop {
+		return intermediates // already saved
+	}
+
+	saved := intermediate{
+		Intermediate: Intermediate{Loop: loop},
+		Geometry:     make([]*geo.Path, len(states)),
+	}
+
+	for i, state := range states {
+		saved.Geometry[i] = state.Path.Clone() // converged paths are no longer replaced every loop
+		saved.Score += state.PathScore / float64(len(states))
+	}
+
+	kept := intermediates[:0]
+	for _, i := range intermediates {
+		if sampler.Keep(i.Loop, loop) {
+			kept = append(kept, i)
+		}
+	}
+
+	return append(kept, saved)
+}
@@ -0,0 +1,67 @@
+package slide
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/paulmach/go.geo"
+)
+
+// sampledLoops runs the sampler over a refinement of the number of loops.
+func sampledLoops(sampler Sampler, loops int) []int {
+	states := []*pathState{{Path: geo.NewPath()}}
+
+	var intermediates []intermediate
+	for loop := 0; loop < loops; loop++ {
+		intermediates = sample(sampler, intermediates, states, loop, false)
+	}
+	intermediates = sample(sampler, intermediates, states, loops-1, true)
+
+	var result []int
+	for _, i := range intermediates {
+		result = append(result, i.Loop)
+	}
+
+	return result
+}
+
+func TestEvenlySpaced(t *testing.T) {
+	cases := []struct {
+		n, loops int
+		expected []int
+	}{
+		{10, 10, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}},
+		{10, 11, []int{0, 2, 4, 6, 8, 10}},
+		{10, 37, []int{0, 4, 8, 12, 16, 20, 24, 28, 32, 36}},
+		{10, 38, []int{0, 8, 16, 24, 32, 37}},
+		{2, 6, []int{0, 5}},
+		{1, 6, []int{5}},
+	}
+
+	for _, c := range cases {
+		if loops := sampledLoops(EvenlySpaced(c.n), c.loops); !reflect.DeepEqual(loops, c.expected) {
+			t.Errorf("%d of %d loops: expected %v, got %v", c.n, c.loops, c.expected, loops)
+		}
+	}
+
+	for _, n := range []int{2, 3, 5, 10, 16} {
+		for total := 1; total < 300; total++ {
+			loops := sampledLoops(EvenlySpaced(n), total)
+
+			if len(loops) > n || len(loops) < minInt(n/2, total) {
+				t.Fatalf("%d of %d loops: saved %d, %v", n, total, len(loops), loops)
+			}
+
+			if loops[0] != 0 && total > 1 || loops[len(loops)-1] != total-1 {
+				t.Fatalf("%d of %d loops: expected the first and last loop, got %v", n, total, loops)
+			}
+
+			// evenly spaced, except for the last
+			for i := 2; i < len(loops)-1; i++ {
+				if loops[i]-loops[i-1] != loops[1]-loops[0] {
+					t.Fatalf("%d of %d loops: not evenly spaced, %v", n, total, loops)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package slide
+
+import (
+	"context"
+	"errors"
+)
+
+// A Stage is one step of a coarse to fine, multi-scale, slide. See DoSchedule.
+// Every field is used as is, use Slide.Stage to start from the current parameters.
+type Stage struct {
+	// SmoothingStdDev is the standard deviation, in meters, the surface
+	// is resmoothed with before the stage.
+	SmoothingStdDev float64
+
+	ResampleInterval float64 // meters
+
+	GradientScale float64
+	DistanceScale float64
+	AngleScale    float64
+	MomentumScale float64
+
+	DepthBasedReduction bool
+
+	MinLoops         int
+	MaxLoops         int
+	ThresholdEpsilon float64
+}
+
+// Stage returns a stage with the given smoothing and the current parameters of the slide.
+func (s *Slide) Stage(smoothingStdDev float64) Stage {
+	return Stage{
+		SmoothingStdDev:  smoothingStdDev,
+		ResampleInterval: s.ResampleInterval,
+
+		GradientScale: s.GradientScale,
+		DistanceScale: s.DistanceScale,
+		AngleScale:    s.AngleScale,
+		MomentumScale: s.MomentumScale,
+
+		DepthBasedReduction: s.DepthBasedReduction,
+
+		MinLoops:         s.MinLoops,
+		MaxLoops:         s.MaxLoops,
+		ThresholdEpsilon: s.ThresholdEpsilon,
+	}
+}
+
+// DoSchedule performs the slide algorithm in stages, typically from a very smooth
+// surface to a sharper one. Before each stage the surface is resmoothed and the
+// paths are resampled and refined using the parameters of the stage, starting
+// where the previous stage ended. The Surfacer must be a Resmoother.
+// The result combines the stages, the loops and intermediate geometries are for all
+// the stages while the last loop values are from the last stage run. The Sampler
+// and NumberIntermediateGeometries of the Slide apply to the whole schedule.
+func (s *Slide) DoSchedule(ctx context.Context, stages []Stage) (*Result, error) {
+	if len(stages) == 0 {
+		return nil, errors.New("slide: please provide at least one stage")
+	}
+
+	resmoother, ok := s.Surfacer.(Resmoother)
+	if !ok {
+		return nil, errors.New("slide: surfacer does not support resmoothing")
+	}
+
+	return s.do(ctx, len(stages), func(i int) (*Slide, error) {
+		err := resmoother.SetSmoothingStdDev(stages[i].SmoothingStdDev)
+		if err != nil {
+			return nil, err
+		}
+
+		return stages[i].apply(s), nil
+	})
+}
+
+// apply returns a copy of the slide with the stage parameters.
+func (stage Stage) apply(s *Slide) *Slide {
+	params := *s
+
+	params.ResampleInterval = stage.ResampleInterval
+
+	params.GradientScale = stage.GradientScale
+	params.DistanceScale = stage.DistanceScale
+	params.AngleScale = stage.AngleScale
+	params.MomentumScale = stage.MomentumScale
+
+	params.DepthBasedReduction = stage.DepthBasedReduction
+
+	params.MinLoops = stage.MinLoops
+	params.MaxLoops = stage.MaxLoops
+	params.ThresholdEpsilon = stage.ThresholdEpsilon
+
+	return &params
+}
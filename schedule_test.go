@@ -0,0 +1,76 @@
+package slide
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/paulmach/go.geo"
+)
+
+// resmoothSurfacer is a benchSurfacer that can be used in a schedule.
+type resmoothSurfacer struct {
+	benchSurfacer
+}
+
+func (resmoothSurfacer) SetSmoothingStdDev(sd float64) error {
+	return nil
+}
+
+func TestDoScheduleLoops(t *testing.T) {
+	input := geo.NewPath()
+	input.Push(geo.NewPoint(-122.0, 37.0))
+	input.Push(geo.NewPoint(-121.998, 37.0002))
+
+	s := New([]*geo.Path{input}, resmoothSurfacer{})
+	s.MinLoops = 5
+	s.ThresholdEpsilon = 1 // converged as soon as MinLoops is reached
+	s.RecordHistory = true
+	s.Sampler = EveryKth(1)
+
+	var progress []int
+	s.OnLoop = func(p *LoopProgress) error {
+		progress = append(progress, p.Loop)
+		return nil
+	}
+
+	result, err := s.DoSchedule(context.Background(), []Stage{s.Stage(2), s.Stage(1)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// every stage runs loops 0 to 5, counted across the stages that is 0 to 11.
+	expected := make([]int, 12)
+	for i := range expected {
+		expected[i] = i
+	}
+
+	if result.LoopsCompleted != len(expected) {
+		t.Errorf("expected %d loops completed, got %d", len(expected), result.LoopsCompleted)
+	}
+
+	var history, intermediates []int
+	for _, r := range result.History {
+		history = append(history, r.Loop)
+	}
+
+	for _, i := range result.Intermediates {
+		intermediates = append(intermediates, i.Loop)
+	}
+
+	if !reflect.DeepEqual(history, expected) {
+		t.Errorf("incorrect history loops: %v", history)
+	}
+
+	if !reflect.DeepEqual(intermediates, expected) {
+		t.Errorf("incorrect intermediate loops: %v", intermediates)
+	}
+
+	if !reflect.DeepEqual(progress, expected) {
+		t.Errorf("incorrect progress loops: %v", progress)
+	}
+
+	if len(result.IntermediateGeometry) != len(expected) {
+		t.Errorf("expected %d intermediate geometries, got %d", len(expected), len(result.IntermediateGeometry))
+	}
+}
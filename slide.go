@@ -1,13 +1,17 @@
 package slide
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"math"
+	"math/rand"
 	"runtime"
 	"time"
 
 	"github.com/paulmach/go.geo"
 	geo_reducers "github.com/paulmach/go.geo/reducers"
+	"github.com/paulmach/slide/metrics"
 	slide_reducers "github.com/paulmach/slide/reducers"
 )
 
@@ -18,6 +22,11 @@ const (
 	DefaultThresholdEpsilon = 0.0005
 
 	DefaultResampleInterval = 5.0 // meters
+
+	DefaultRepulsionScale = 0.5 // used if MinSeparation is set
+
+	DefaultPerturbation = 10.0 // meters, used if Restarts is set
+	DefaultCooling      = 0.95 // used if Temperature is set
 )
 
 // Slide is the struct that holds all the information to perform a slide.
@@ -34,43 +43,202 @@ type Slide struct {
 	// See the internal "score" function for more details.
 	ThresholdEpsilon float64
 
+	// Convergence decides when each path is done refining, MaxLoops is always the limit.
+	// Defaults to ScoreDelta(MinLoops, ThresholdEpsilon) if nil.
+	Convergence Convergence
+
 	// meters to resample the geometries into before sliding,
 	// can impact performance.
 	ResampleInterval float64
 
+	// AdaptiveInterval is how often, in loops, vertices are inserted where the path is
+	// sparse or bends sharply and removed where they are redundant, such as on straight
+	// stretches. Spacing is relative to the ResampleInterval. Zero disables it.
+	AdaptiveInterval int
+
 	// weights for the different components of the cost function.
 	GradientScale float64
 	DistanceScale float64
 	AngleScale    float64
 	MomentumScale float64
 
+	// TetherScale is the weight of an elastic force pulling the vertices
+	// back toward the closest point of the input path. Defaults to zero, no tether.
+	TetherScale float64
+
+	// MinSeparation, in meters, is the distance paths slid together are kept apart by
+	// a repulsion weighted by RepulsionScale. Parts of the same path and paths connected
+	// by a junction do not repel. Zero, the default, is no repulsion.
+	MinSeparation  float64
+	RepulsionScale float64
+
+	// MaxDisplacement, in meters, is the furthest a vertex can move from the input path.
+	// It keeps the slide within a known corridor of the input. Zero is no limit.
+	MaxDisplacement float64
+
+	// NewOptimizer creates the optimizer that turns the contributions into the correction
+	// of the vertices, it is called for every path and junction, every stage. Defaults to
+	// momentum gradient descent using MomentumScale if nil. See NewNesterov, NewAdam and NewLBFGS for others.
+	NewOptimizer func() Optimizer
+
 	// set to the default internal values of gradientContribution, distanceContribution and angleContribution
 	// but if you want to get fancy, you can override them.
 	GradientContributionFunc func(surfacer Surfacer, point *geo.Point, scale float64) *geo.Point
 	DistanceContributionFunc func(path *geo.Path, index int, scale float64) *geo.Point
 	AngleContributionFunc    func(path *geo.Path, index int, scale float64) *geo.Point
 
+	// Terms are the forces acting on the vertices. Defaults to the distance, angle and
+	// gradient terms built from the scales and contribution funcs above, plus the tether
+	// if TetherScale is set and the repulsion if MinSeparation is set. If Terms is set the
+	// gradient, distance and angle scales, the contribution funcs, TetherScale, MinSeparation
+	// and RepulsionScale are ignored.
+	// Stage parameters of a schedule only apply to the default terms.
+	Terms []EnergyTerm
+
 	// Reduce the correction for paths that are in the valley of the surface.
 	// The reduction is based on the original surface value.
 	// This option can be helpful when sliding to good data, such as rasterized vector geometry.
 	DepthBasedReduction bool
 
+	// PreserveTopology keeps the paths from folding over themselves, such as at tight
+	// switchbacks when the distance and angle scales are weak. Corrections that make
+	// a path cross itself are damped or rejected and any remaining loops are removed
+	// before the GeoReducer. Paths are only checked against themselves, across all their
+	// segments, loops around a junction or constrained vertex are kept.
+	PreserveTopology bool
+
+	// SupportThreshold is the surface value below which a refined vertex is not supported by
+	// the surface data, such as no heat or no overlay pixels. Runs of these vertices are
+	// reported in Result.Unsupported. Zero, the default, disables the check.
+	SupportThreshold float64
+
+	// KeepUnsupported moves the unsupported vertices back to the input path so parts
+	// without data are not changed. Junctions are not moved back.
+	KeepUnsupported bool
+
+	// ReuseVertices builds the corrected geometry from the moved input vertices, so every
+	// input vertex is in the output, see Result.Vertices. The refined path between them is
+	// simplified by the GeoReducer and vertices are only added where needed to follow it.
+	ReuseVertices bool
+
+	// Junctions are the vertices shared between the paths, such as road intersections.
+	// Each junction is moved as one vertex so the output has the same topology as the input.
+	Junctions []Junction
+
+	// Constraints limit the movement of input vertices, pinning them in place
+	// or keeping them within a radius of their original location.
+	Constraints []Constraint
+
+	// Closed slides the paths as closed rings, see NewRings.
+	Closed bool
+
+	// Projection is the planar space the slide is done in. Defaults to WebMercator,
+	// EPSG:3857, if nil. Distances in meters, such as the ResampleInterval and MaxDisplacement,
+	// are converted using the scale at every vertex. See AutoUTM, NewUTM and NewProjection.
+	Projection Projection
+
+	// Restarts is the number of extra slides from randomly perturbed starting paths, to escape
+	// local minima such as a path halfway between two valleys. Every restart offsets the
+	// paths sideways by a smooth bump of up to Perturbation meters, keeping the endpoints,
+	// junctions and constrained vertices in place. The result with the lowest final energy,
+	// including the unperturbed start, is returned. Zero, the default, is no restarts.
+	Restarts     int
+	Perturbation float64
+
+	// Temperature, in meters, is the standard deviation of random noise added to every
+	// correction, simulated annealing, to shake the paths off weak ridges early on.
+	// The noise is multiplied by Cooling every loop, so it fades as the paths converge.
+	// Zero, the default, is no noise.
+	Temperature float64
+	Cooling     float64
+
+	// Seed is the seed of the random perturbations and noise. The same seed gives
+	// the same result, including in Deterministic mode.
+	Seed int64
+
+	// Deterministic guarantees a bit-identical Result for the same input, parameters and
+	// surface, on the same architecture, regardless of Goroutines. The work split between
+	// goroutines never changes the results but the wall clock does, so in this mode
+	// LoopState.Elapsed and Result.Runtime are always zero and a Budget of any positive
+	// duration never converges. A cancelled context or OnLoop error still stops the slide at any loop.
+	// Custom Surfacers, Terms, Optimizers and Convergence rules must also be deterministic.
+	Deterministic bool
+
 	// NumberIntermediateGeometries is the steps of the refinement processes to save.
 	// This is for debugging or animation.
 	NumberIntermediateGeometries int
 
-	latLngBound *geo.Bound
+	// RecordHistory records the scores, energy and movement of every loop in Result.History.
+	// Useful for tuning the scale parameters. Off by default to limit memory.
+	RecordHistory bool
+
+	// ComputeMetrics compares the input and corrected paths in Result.Metrics, see the metrics
+	// package. Off by default, the metrics can take as long as the slide for long paths.
+	ComputeMetrics bool
+
+	// Sampler chooses the loops saved as intermediate geometries, see EveryKth, Logarithmic
+	// and EvenlySpaced. Defaults to FirstLoops(NumberIntermediateGeometries) if nil.
+	// With DoSchedule the loops are counted across all the stages and sampled as one run.
+	Sampler Sampler
+
+	// OnLoop, if set, is called after every refinement loop with the current state.
+	// This can be used to stream progress or record convergence. Returning an error
+	// stops the refinement and Do returns the partial result along with the error.
+	OnLoop func(progress *LoopProgress) error
 }
 
 // Result is the structure containing the results of the sliding process.
-// Geometries will be paths in lat/lng (EPSG:4326).
+// Geometries will be paths in lat/lng (EPSG:4326), one per input path and in the same order.
+// LoopsCompleted is the loop count of the slowest converging path, LastLoopError is the
+// largest last loop error of all the paths and LastLoopScore is the average last loop score.
 type Result struct {
 	CorrectedGeometry    []*geo.Path
 	IntermediateGeometry [][]*geo.Path
+	Intermediates        []Intermediate // loop and score of the IntermediateGeometry
 	LoopsCompleted       int
 	LastLoopError        float64
 	LastLoopScore        float64
 	Runtime              time.Duration
+
+	// Per vertex values aligned with CorrectedGeometry.
+	// Displacements are the distance, in meters, from the input path.
+	// SurfaceValues are the Surfacer.ValueAt of the vertex. Confidences are in [0, 1]
+	// and are the surface value averaged along the path around the vertex.
+	Displacements [][]float64
+	SurfaceValues [][]float64
+	Confidences   [][]float64
+
+	// Vertices are where every input vertex ended up, aligned with the input Geometry.
+	// Vertices keep their fraction of the length between junctions and path endpoints.
+	Vertices [][]MappedVertex
+
+	// Unsupported are the parts of the paths without surface support, see SupportThreshold.
+	Unsupported []UnsupportedSegment
+
+	// History is the record of every loop if RecordHistory is set.
+	History History
+
+	// Metrics are how much each path changed, the input compared to the CorrectedGeometry,
+	// if ComputeMetrics is set.
+	Metrics []metrics.Summary
+
+	// Energy is the total energy of the refined paths using the terms of the last stage. The paths
+	// are resampled to the vertex count of the input at the last ResampleInterval so the energy
+	// does not depend on the vertices and can be compared between the restarts.
+	// Restart is the start it came from, zero being the input, see Slide.Restarts.
+	Energy  float64
+	Restart int
+}
+
+// LoopProgress is the state of the refinement after a loop, see Slide.OnLoop.
+// The values are per input path. For networks the values of the segments of a path
+// are combined, the scores are averaged by vertex count and the delta is the maximum.
+type LoopProgress struct {
+	Loop       int         // counted across all the stages of a schedule, like the History
+	Geometry   []*geo.Path // lat/lng (EPSG:4326) and not simplified by the GeoReducer
+	PathScores []float64   // average surface value of the path
+	Scores     []float64   // exponentially smoothed path scores
+	Deltas     []float64   // change in the smoothed scores, compared to ThresholdEpsilon
 }
 
 // New creates a new Slide structure with the default parameters.
@@ -93,6 +261,10 @@ func New(geometry []*geo.Path, surfacer Surfacer) *Slide {
 		AngleScale:    suggested.AngleScale,
 		MomentumScale: suggested.MomentumScale,
 
+		RepulsionScale: DefaultRepulsionScale,
+		Perturbation:   DefaultPerturbation,
+		Cooling:        DefaultCooling,
+
 		GradientContributionFunc: gradientContribution,
 		DistanceContributionFunc: distanceContribution,
 		AngleContributionFunc:    angleContribution,
@@ -102,80 +274,230 @@ func New(geometry []*geo.Path, surfacer Surfacer) *Slide {
 }
 
 // Do performs the slide algorithm which includes the following:
-// - transform geometries into EPSG:3857 and resample
+// - split the geometries into segments at the junctions and constrained vertices
+// - transform geometries into the Projection, EPSG:3857 by default, and resample
 // - iterate and refine path
 // - transform the result back into EPSG:4326
+// - repeat from perturbed starting paths if Restarts is set and keep the lowest energy
+//
+// The input geometry and the Slide are not modified, all the work is done on copies.
+// So a Slide can be run again, for example after changing some of the parameters.
 func (s *Slide) Do() (*Result, error) {
+	return s.DoContext(context.Background())
+}
+
+// DoContext performs the slide algorithm, same as Do, but stops refining when
+// the context is cancelled or its deadline passes. In that case the partial result,
+// as of the last completed loop, is returned along with ctx.Err().
+func (s *Slide) DoContext(ctx context.Context) (*Result, error) {
+	return s.do(ctx, 1, func(int) (*Slide, error) { return s, nil })
+}
+
+// do runs the slide algorithm in one or more stages. For every stage the paths are
+// resampled and refined using the parameters of the Slide returned by the stage function.
+// The refined paths of one stage are the input to the next. With Restarts all the stages
+// are run again for every restart.
+func (s *Slide) do(ctx context.Context, stages int, stage func(i int) (*Slide, error)) (*Result, error) {
 
 	if len(s.Geometry) == 0 {
 		return nil, errors.New("slide: please provide at least one path")
 	}
 
-	if len(s.Geometry) > 1 {
-		return nil, errors.New("slide: currently the sliding of only one path is supported")
+	for i, p := range s.Geometry {
+		if p == nil {
+			return nil, fmt.Errorf("slide: geometry[%d] is nil", i)
+		}
+
+		if p.Length() < 2 {
+			return nil, fmt.Errorf("slide: geometry[%d] path less than 2 points", i)
+		}
+
+		if s.Closed && ringLength(p) < 3 {
+			return nil, fmt.Errorf("slide: geometry[%d] ring less than 3 points", i)
+		}
 	}
 
-	if s.Geometry[0] == nil {
-		return nil, errors.New("slide: geometry[0] is nil")
+	start := time.Now()
+
+	var (
+		best *Result
+		err  error
+	)
+
+	for i := 0; i <= maxInt(s.Restarts, 0); i++ {
+		result, runErr := s.run(ctx, stages, stage, i)
+		if result != nil && (best == nil || result.Energy < best.Energy) {
+			best = result
+		}
+
+		// the partial result of a stopped restart can still be the best.
+		if runErr != nil {
+			err = runErr
+			break
+		}
 	}
 
-	if s.Geometry[0].Length() < 2 {
-		return nil, errors.New("slide: path less than 2 points")
+	if best != nil {
+		if s.ComputeMetrics {
+			s.compare(best)
+		}
+
+		best.Runtime = s.since(start)
 	}
 
-	start := time.Now()
+	return best, err
+}
 
-	if s.Goroutines < 1 {
-		s.Goroutines = 1
+// run is one slide, of all the stages, from the input or, for restarts, perturbed paths.
+// The perturbations and annealing noise are seeded with the Seed and the restart.
+// The Runtime and Metrics are set by do for the chosen result.
+func (s *Slide) run(ctx context.Context, stages int, stage func(i int) (*Slide, error), restart int) (*Result, error) {
+	net, err := s.buildNetwork()
+	if err != nil {
+		return nil, err
 	}
 
-	s.latLngBound = s.Geometry[0].Bound()
-	for i := 1; i < len(s.Geometry); i++ {
-		s.latLngBound.Union(s.Geometry[i].Bound())
+	random := rand.New(rand.NewSource(s.Seed + int64(restart)))
+
+	// the surfacer is converted to the projection, if needed.
+	s = s.withProjection(s.projection())
+
+	// the paths are split into segments at the junctions, without junctions
+	// there is one segment per path. These are copies, the input geometry is not modified.
+	paths := net.segmentPaths()
+	for i := range paths {
+		// The slider works in the projected space, EPSG:3857 by default
+		paths[i].Transform(s.Projection.Project)
 	}
 
-	scaleFactor := geo.MercatorScaleFactor(s.latLngBound.Center().Lat())
+	net.setOrigins(paths, s.Projection)
+
+	result := &Result{Restart: restart}
+	samples := &sampling{Sampler: s.sampler()}
 
-	for i := range s.Geometry {
-		// The slider works in EPSG:3857
-		s.Geometry[i].Transform(geo.Mercator.Project)
+	var last *Slide // the parameters of the last stage run
 
-		// resamples the path so that there is a data point
-		// at least every options.PathResampleInterval meters.
-		// This makes sure the path initially satisfies the equidistant constraint.
-		distance := s.Geometry[0].Distance()
-		count := int(math.Ceil(distance / (s.ResampleInterval * scaleFactor)))
-		s.Geometry[i].Resample(count + 3)
+	for i := 0; i < stages; i++ {
+		params, stageErr := stage(i)
+		if stageErr != nil {
+			return nil, stageErr
+		}
+		params = params.withProjection(s.Projection)
+		last = params
+
+		for j := range paths {
+			// resamples the path so that there is a data point
+			// at least every options.PathResampleInterval meters.
+			// This makes sure the path initially satisfies the equidistant constraint.
+			distance := metricLength(paths[j], s.Projection)
+			count := int(math.Ceil(distance / params.ResampleInterval))
+			paths[j].Resample(count + 3)
+		}
+
+		if i == 0 && restart > 0 {
+			perturb(paths, s.Projection, s.Perturbation, random)
+		}
+
+		// slide all the paths together
+		// a cancelled context still returns the partial result, with the error.
+		samples.Final = i == stages-1
+
+		stageResult, refineErr := params.refine(ctx, paths, net, random, samples, result.LoopsCompleted)
+
+		paths = stageResult.CorrectedGeometry
+		result.CorrectedGeometry = stageResult.CorrectedGeometry
+		result.History = append(result.History, stageResult.History...)
+
+		result.LoopsCompleted += stageResult.LoopsCompleted
+		result.LastLoopError = stageResult.LastLoopError
+		result.LastLoopScore = stageResult.LastLoopScore
+
+		if refineErr != nil {
+			err = refineErr
+			break
+		}
 	}
 
-	// slide the single path
-	result, err := s.refine()
-	if err != nil {
-		return nil, err
+	result.Energy = last.resampledEnergy(net, result.CorrectedGeometry)
+
+	for _, i := range samples.Intermediates {
+		result.IntermediateGeometry = append(result.IntermediateGeometry, i.Geometry)
+		result.Intermediates = append(result.Intermediates, i.Intermediate)
 	}
 
+	corrected := s.removeLoops(net, result.CorrectedGeometry)
+	result.Unsupported = s.unsupported(net, corrected)
+	moved := net.movedVertices(corrected)
+
 	// convert everything back into the lat/lng space and simplify.
+	// Segments are simplified individually so junctions are preserved.
 	// TODO: find a better reducer.
-	for i, p := range result.CorrectedGeometry {
-		p.Transform(geo.Mercator.Inverse)
-		if s.GeoReducer != nil {
-			result.CorrectedGeometry[i] = s.GeoReducer.GeoReduce(p)
-		} else {
-			result.CorrectedGeometry[i] = p
-		}
+	if s.ReuseVertices {
+		result.CorrectedGeometry = net.join(s.reuseVertices(net, corrected, moved))
+	} else {
+		result.CorrectedGeometry = net.join(s.reduce(net, corrected))
 	}
 
 	for i := range result.IntermediateGeometry {
-		for j, p := range result.IntermediateGeometry[i] {
-			p.Transform(geo.Mercator.Inverse)
-			if s.GeoReducer != nil {
-				result.IntermediateGeometry[i][j] = s.GeoReducer.GeoReduce(p)
-			} else {
-				result.IntermediateGeometry[i][j] = p
-			}
-		}
+		result.IntermediateGeometry[i] = net.join(s.reduce(net, s.removeLoops(net, result.IntermediateGeometry[i])))
+	}
+
+	result.Vertices = net.mapVertices(moved, result.CorrectedGeometry, s.Geometry)
+	s.analyze(result, net.Geometry)
+
+	return result, err
+}
+
+// compare fills in the metrics of the result, comparing the input and corrected paths.
+func (s *Slide) compare(result *Result) {
+	geometry := s.Geometry
+	if s.Closed {
+		geometry = closeRings(geometry) // the corrected rings are closed
+	}
+
+	result.Metrics = make([]metrics.Summary, len(result.CorrectedGeometry))
+	for i, p := range result.CorrectedGeometry {
+		result.Metrics[i] = metrics.Compare(geometry[i], p)
+	}
+}
+
+// removeLoops removes any loops left in the segment paths if PreserveTopology is set.
+func (s *Slide) removeLoops(net *network, paths []*geo.Path) []*geo.Path {
+	if s.PreserveTopology {
+		return net.removeLoops(paths)
+	}
+
+	return paths
+}
+
+// reduce transforms the segment paths back into lat/lng space and runs them through the GeoReducer.
+// Ends that did not move keep their exact input coordinates, see network.inverse.
+func (s *Slide) reduce(net *network, paths []*geo.Path) []*geo.Path {
+	for i, p := range paths {
+		start := net.inverse(i, 0, p.GetAt(0))
+		end := net.inverse(i, net.Originals[i].Length()-1, p.GetAt(p.Length()-1))
+
+		p.Transform(s.Projection.Inverse)
+		*p.GetAt(0), *p.GetAt(p.Length() - 1) = start, end
+
+		first, last := net.endpoints(i)
+		paths[i] = s.geoReduce(p, first, last)
+	}
+
+	return paths
+}
+
+// geoReduce runs the path through the GeoReducer. A Trim reducer only trims the ends
+// that are input path endpoints, the others are junctions or constrained vertices
+// that move freely and the refined path around them is kept.
+func (s *Slide) geoReduce(path *geo.Path, first, last bool) *geo.Path {
+	if s.GeoReducer == nil {
+		return path
+	}
+
+	if trim, ok := s.GeoReducer.(*slide_reducers.Trim); ok {
+		return trim.GeoReduceEnds(path, first, last)
 	}
 
-	result.Runtime = time.Since(start)
-	return result, nil
+	return s.GeoReducer.GeoReduce(path)
 }
@@ -0,0 +1,96 @@
+package slide
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/paulmach/go.geo"
+)
+
+// junctionNetwork is three paths meeting at a junction at center,
+// long enough to be split between the workers.
+func junctionNetwork() ([]*geo.Path, []Junction) {
+	center := geo.NewPoint(-122.0, 37.0)
+
+	west := geo.NewPath()
+	west.Push(geo.NewPoint(-122.02, 37.0003))
+	west.Push(geo.NewPoint(-122.01, 36.9998))
+	west.Push(center)
+
+	east := geo.NewPath()
+	east.Push(center)
+	east.Push(geo.NewPoint(-121.99, 37.0004))
+	east.Push(geo.NewPoint(-121.98, 37.0010))
+
+	north := geo.NewPath()
+	north.Push(center)
+	north.Push(geo.NewPoint(-122.0004, 37.008))
+	north.Push(geo.NewPoint(-121.9995, 37.016))
+
+	geometry := []*geo.Path{west, east, north}
+	junctions := []Junction{{{Path: 0, Index: 2}, {Path: 1, Index: 0}, {Path: 2, Index: 0}}}
+
+	return geometry, junctions
+}
+
+func TestSlideDeterministic(t *testing.T) {
+	geometry, junctions := junctionNetwork()
+
+	do := func(goroutines int) *Result {
+		s := NewNetwork(geometry, junctions, benchSurfacer{})
+		s.Goroutines = goroutines
+		s.Deterministic = true
+		s.RecordHistory = true
+		s.Sampler = EveryKth(10)
+
+		result, err := s.Do()
+		if err != nil {
+			t.Fatalf("goroutines %d: unexpected error: %v", goroutines, err)
+		}
+
+		return result
+	}
+
+	expected := do(1)
+	for _, goroutines := range []int{2, 3, 8, 16} {
+		if result := do(goroutines); !reflect.DeepEqual(result, expected) {
+			t.Errorf("goroutines %d: result not the same as with 1 goroutine", goroutines)
+		}
+	}
+}
+
+func TestDoInputUnchanged(t *testing.T) {
+	geometry, junctions := junctionNetwork()
+
+	input := make([]*geo.Path, len(geometry))
+	for i, p := range geometry {
+		input[i] = p.Clone()
+	}
+
+	s := NewNetwork(geometry, junctions, benchSurfacer{})
+	s.Constraints = []Constraint{{Vertex: VertexRef{Path: 2, Index: 1}, Radius: 5}}
+	s.Deterministic = true
+	s.RecordHistory = true
+	s.NumberIntermediateGeometries = 3
+
+	first, err := s.Do()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for i, p := range geometry {
+		if !reflect.DeepEqual(p.Points(), input[i].Points()) {
+			t.Errorf("geometry[%d] modified: %v != %v", i, p.Points(), input[i].Points())
+		}
+	}
+
+	// the slide is not modified, running it again gives the same result.
+	second, err := s.Do()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("second Do not the same as the first")
+	}
+}
@@ -0,0 +1,74 @@
+package slide
+
+import (
+	"github.com/paulmach/go.geo"
+)
+
+// An UnsupportedSegment is a run of refined vertices with surface values
+// below the SupportThreshold, where the slide was not driven by the surface.
+type UnsupportedSegment struct {
+	Path     int       // index of the input path
+	Geometry *geo.Path // lat/lng (EPSG:4326), the refined vertices before the GeoReducer
+	Length   float64   // meters
+}
+
+// unsupported finds the runs of vertices of the refined, projected, segment paths with
+// surface values below the SupportThreshold. If KeepUnsupported is set the vertices of the runs
+// are moved back to the closest point of the original path, except for junctions.
+func (s *Slide) unsupported(net *network, paths []*geo.Path) []UnsupportedSegment {
+	if s.SupportThreshold <= 0 {
+		return nil
+	}
+
+	var (
+		segments []UnsupportedSegment
+		current  *geo.Path // the run, continued at the start of the next segment of the path
+	)
+
+	for i, path := range paths {
+		if current != nil && (i == 0 || net.Segments[i-1].Path != net.Segments[i].Path) {
+			segments = append(segments, s.unsupportedSegment(net.Segments[i-1].Path, current))
+			current = nil
+		}
+
+		for j := 0; j < path.Length(); j++ {
+			point := path.GetAt(j)
+			if s.Surfacer.ValueAt(point) >= s.SupportThreshold {
+				if current != nil {
+					segments = append(segments, s.unsupportedSegment(net.Segments[i].Path, current))
+					current = nil
+				}
+
+				continue
+			}
+
+			if s.KeepUnsupported && j > 0 && j < path.Length()-1 {
+				*point = *closestOnPath(point, net.Originals[i])
+			}
+
+			if current == nil {
+				current = geo.NewPath()
+			} else if j == 0 {
+				continue // the last point of the previous segment
+			}
+
+			current.Push(point)
+		}
+	}
+
+	if current != nil {
+		segments = append(segments, s.unsupportedSegment(net.Segments[len(paths)-1].Path, current))
+	}
+
+	return segments
+}
+
+// unsupportedSegment converts the projected run of vertices.
+func (s *Slide) unsupportedSegment(path int, run *geo.Path) UnsupportedSegment {
+	length := metricLength(run, s.Projection)
+	return UnsupportedSegment{
+		Path:     path,
+		Geometry: run.Transform(s.Projection.Inverse),
+		Length:   length,
+	}
+}
@@ -5,7 +5,8 @@ import (
 )
 
 // A Surfacer defines what a surface needs to do to be used for sliding.
-// It should define a surface in the mercator projected space (EPSG:3857).
+// It should define a surface in the mercator projected space (EPSG:3857),
+// or implement ProjectedSurfacer if defined in another projection.
 // Better values should be positive with a maximum of 1 meter, scaled up
 // to be consistent with the EPSG:3857 scaling factor for that latitude.
 type Surfacer interface {
@@ -29,3 +30,19 @@ type SuggestedOptions struct {
 	// reduce the correction based on surface depth
 	DepthBasedReduction bool
 }
+
+// A Resmoother is a Surfacer where the smoothing of the surface can be changed.
+// It is required for multi-scale sliding, see DoSchedule.
+type Resmoother interface {
+	Surfacer
+
+	// SetSmoothingStdDev resmooths the surface using the standard deviation in meters.
+	SetSmoothingStdDev(stdDev float64) error
+}
+
+// A SmoothValuer is a Surfacer that also provides the value of the smoothed surface,
+// the surface GradientAt is derived from. It is used by PathEnergy, if available,
+// so the energy is consistent with the gradient.
+type SmoothValuer interface {
+	SmoothValueAt(point *geo.Point) float64
+}
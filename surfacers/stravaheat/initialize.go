@@ -145,6 +145,11 @@ func (surfacer *Surface) ValueAt(point *geo.Point) float64 {
 	return surfacer.Surface.ValueAt(point)
 }
 
+// SmoothValueAt provides a pass through to surfacer.SmoothSurface.ValueAt()
+func (surfacer *Surface) SmoothValueAt(point *geo.Point) float64 {
+	return surfacer.SmoothSurface.ValueAt(point)
+}
+
 // SuggestedOptions returns the defaults slide should use for some parameters.
 func (surfacer *Surface) SuggestedOptions() *slide.SuggestedOptions {
 	return &slide.SuggestedOptions{
@@ -2,6 +2,7 @@ package stravaheat
 
 import (
 	"github.com/paulmach/go.geo"
+	"github.com/paulmach/slide/surfacers"
 	"github.com/paulmach/slide/utils"
 	"github.com/paulmach/slide/utils/smoothsurface"
 )
@@ -18,6 +19,17 @@ func (surfacer *Surface) Resmooth() error {
 	return nil
 }
 
+// SetSmoothingStdDev updates `SmoothingStdDev` and resmooths the surface.
+// This makes the surface a slide.Resmoother so it can be used for multi-scale sliding.
+func (surfacer *Surface) SetSmoothingStdDev(stdDev float64) error {
+	if stdDev < 0.0 {
+		return surfacers.ErrStdDevNegative
+	}
+
+	surfacer.SmoothingStdDev = stdDev
+	return surfacer.Resmooth()
+}
+
 // smooth sets up the LazySmoothSurface with a kernel.
 func (surfacer *Surface) smooth() error {
 	surfacer.SmoothSurface = smoothsurface.New(surfacer.Surface, surfacer.smoothKernel())
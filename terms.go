@@ -0,0 +1,279 @@
+package slide
+
+import (
+	"reflect"
+
+	"github.com/paulmach/go.geo"
+)
+
+// An EnergyTerm is one of the forces acting on the vertices during refinement.
+// The default terms are the distance, angle and gradient contributions, plus the tether
+// if TetherScale is set. Set Slide.Terms to replace them or add new forces.
+// Terms are weighted by their own parameters, such as the Scale of the built in terms.
+type EnergyTerm interface {
+	// Force returns the contribution, in projected units, for the vertex at the index of the path.
+	// It is only called for vertices with a predecessor and successor.
+	Force(path *geo.Path, index int, env *Environment) *geo.Point
+
+	// Energy of the whole path for this term, lower is better. The force should
+	// approximately be its negative gradient. Used by line search optimizers and convergence.
+	Energy(path *geo.Path, env *Environment) float64
+}
+
+// Environment is the information, beyond the path, available to the energy terms.
+type Environment struct {
+	Surfacer   Surfacer
+	Projection Projection
+
+	// Original is the projected path before resampling and refinement.
+	// For junctions it is only the original location of the junction. May be nil.
+	Original *geo.Path
+
+	// Others are the current projected paths that are slid together with this path,
+	// excluding other parts of the same input path and paths connected to it by a junction.
+	Others []*geo.Path
+}
+
+// GradientTerm pulls the vertices toward the valleys of the surface, better values,
+// using the Surfacer.GradientAt.
+type GradientTerm struct {
+	Scale float64
+
+	// Contribution defaults to the internal gradient contribution if nil.
+	Contribution func(surfacer Surfacer, point *geo.Point, scale float64) *geo.Point
+}
+
+// Force returns the scaled surface gradient at the vertex.
+func (t GradientTerm) Force(path *geo.Path, index int, env *Environment) *geo.Point {
+	contribution := t.Contribution
+	if contribution == nil {
+		contribution = gradientContribution
+	}
+
+	return contribution(env.Surfacer, path.GetAt(index), t.Scale)
+}
+
+func (t GradientTerm) forceValue(path *geo.Path, index int, env *Environment) geo.Point {
+	if t.Contribution != nil {
+		return *t.Contribution(env.Surfacer, path.GetAt(index), t.Scale)
+	}
+
+	return gradientForce(env.Surfacer, path.GetAt(index), t.Scale)
+}
+
+// Energy is the negative surface value summed over the vertices,
+// using SmoothValueAt if the Surfacer is a SmoothValuer.
+func (t GradientTerm) Energy(path *geo.Path, env *Environment) float64 {
+	valueAt := env.Surfacer.ValueAt
+	if smooth, ok := env.Surfacer.(SmoothValuer); ok {
+		valueAt = smooth.SmoothValueAt
+	}
+
+	sum := 0.0
+	for i := 0; i < path.Length(); i++ {
+		sum -= valueAt(path.GetAt(i))
+	}
+
+	return t.Scale * sum
+}
+
+// DistanceTerm keeps the vertices equally spaced along the path.
+type DistanceTerm struct {
+	Scale float64
+
+	// Contribution defaults to the internal distance contribution if nil.
+	Contribution func(path *geo.Path, index int, scale float64) *geo.Point
+}
+
+// Force moves the vertex toward the middle of its neighbours, along the path.
+func (t DistanceTerm) Force(path *geo.Path, index int, env *Environment) *geo.Point {
+	contribution := t.Contribution
+	if contribution == nil {
+		contribution = distanceContribution
+	}
+
+	return contribution(path, index, t.Scale)
+}
+
+func (t DistanceTerm) forceValue(path *geo.Path, index int, env *Environment) geo.Point {
+	if t.Contribution != nil {
+		return *t.Contribution(path, index, t.Scale)
+	}
+
+	return distanceForce(path, index, t.Scale)
+}
+
+// Energy is a spring between neighbouring vertices.
+func (t DistanceTerm) Energy(path *geo.Path, env *Environment) float64 {
+	spring := 0.0
+	for i := 1; i < path.Length(); i++ {
+		spring += path.GetAt(i).SquaredDistanceFrom(path.GetAt(i - 1))
+	}
+
+	return t.Scale * spring / 2
+}
+
+// AngleTerm straightens the path by maximizing the vertex angles.
+type AngleTerm struct {
+	Scale float64
+
+	// Contribution defaults to the internal angle contribution if nil.
+	Contribution func(path *geo.Path, index int, scale float64) *geo.Point
+}
+
+// Force moves the vertex toward the line between its neighbours.
+func (t AngleTerm) Force(path *geo.Path, index int, env *Environment) *geo.Point {
+	contribution := t.Contribution
+	if contribution == nil {
+		contribution = angleContribution
+	}
+
+	return contribution(path, index, t.Scale)
+}
+
+func (t AngleTerm) forceValue(path *geo.Path, index int, env *Environment) geo.Point {
+	if t.Contribution != nil {
+		return *t.Contribution(path, index, t.Scale)
+	}
+
+	return angleForce(path, index, t.Scale)
+}
+
+// Energy is a bending term on the second difference of the vertices.
+func (t AngleTerm) Energy(path *geo.Path, env *Environment) float64 {
+	bending := 0.0
+	for i := 1; i < path.Length()-1; i++ {
+		second := path.GetAt(i - 1).Clone().Add(path.GetAt(i + 1)).Subtract(path.GetAt(i).Clone().Scale(2))
+		bending += second.Dot(second)
+	}
+
+	return t.Scale * bending / 4
+}
+
+// TetherTerm is an elastic pulling the vertices back toward the closest point of
+// the original path. It does nothing if there is no original path.
+type TetherTerm struct {
+	Scale float64
+}
+
+// Force pulls the vertex toward the closest point of the original path, like a spring.
+func (t TetherTerm) Force(path *geo.Path, index int, env *Environment) *geo.Point {
+	if t.Scale == 0 || env.Original == nil {
+		return geo.NewPoint(0, 0)
+	}
+
+	point := path.GetAt(index)
+	return closestOnPath(point, env.Original).Subtract(point).Scale(t.Scale)
+}
+
+// Energy is the spring energy of the tether.
+func (t TetherTerm) Energy(path *geo.Path, env *Environment) float64 {
+	if t.Scale == 0 || env.Original == nil {
+		return 0
+	}
+
+	tether := 0.0
+	for i := 0; i < path.Length(); i++ {
+		tether += path.GetAt(i).SquaredDistanceFrom(closestOnPath(path.GetAt(i), env.Original))
+	}
+
+	return t.Scale * tether / 2
+}
+
+// RepulsionTerm pushes the vertices away from the other paths slid together with the path
+// when they are closer than the separation. It keeps parallel paths, such as dual carriageways,
+// from sliding onto the same line.
+type RepulsionTerm struct {
+	Scale      float64
+	Separation float64 // meters
+}
+
+// Force pushes the vertex away from the closest point of every other path within the separation,
+// like a spring compressed by the overlap.
+func (t RepulsionTerm) Force(path *geo.Path, index int, env *Environment) *geo.Point {
+	force := geo.NewPoint(0, 0)
+	if t.Scale == 0 || len(env.Others) == 0 {
+		return force
+	}
+
+	point := path.GetAt(index)
+	separation := t.Separation * env.Projection.ScaleFactor(point)
+
+	for _, other := range env.Others {
+		away := point.Clone().Subtract(closestOnPath(point, other))
+		d := away.DistanceFrom(geo.NewPoint(0, 0))
+		if d == 0 || d >= separation {
+			continue
+		}
+
+		force.Add(away.Scale(t.Scale * (separation - d) / d))
+	}
+
+	return force
+}
+
+// Energy is the spring energy of the overlaps.
+func (t RepulsionTerm) Energy(path *geo.Path, env *Environment) float64 {
+	if t.Scale == 0 || len(env.Others) == 0 {
+		return 0
+	}
+
+	sum := 0.0
+	for i := 0; i < path.Length(); i++ {
+		point := path.GetAt(i)
+		separation := t.Separation * env.Projection.ScaleFactor(point)
+
+		for _, other := range env.Others {
+			if d := distanceToPath(point, other); d < separation {
+				sum += (separation - d) * (separation - d)
+			}
+		}
+	}
+
+	return t.Scale * sum / 2
+}
+
+// terms returns the energy terms to use, defaults to the terms
+// built from the scale parameters and contribution functions.
+func (s *Slide) terms() []EnergyTerm {
+	if s.Terms != nil {
+		return s.Terms
+	}
+
+	// the default contribution funcs are left nil so the terms can add them without allocating.
+	gradient := s.GradientContributionFunc
+	if sameFunc(gradient, gradientContribution) {
+		gradient = nil
+	}
+
+	distance, angle := s.DistanceContributionFunc, s.AngleContributionFunc
+	if sameFunc(distance, distanceContribution) {
+		distance = nil
+	}
+
+	if sameFunc(angle, angleContribution) {
+		angle = nil
+	}
+
+	// the order matches the original sum of the contributions
+	terms := []EnergyTerm{
+		DistanceTerm{Scale: s.DistanceScale, Contribution: distance},
+		AngleTerm{Scale: s.AngleScale, Contribution: angle},
+		GradientTerm{Scale: s.GradientScale, Contribution: gradient},
+	}
+
+	if s.TetherScale != 0 {
+		terms = append(terms, TetherTerm{Scale: s.TetherScale})
+	}
+
+	if s.MinSeparation > 0 {
+		terms = append(terms, RepulsionTerm{Scale: s.RepulsionScale, Separation: s.MinSeparation})
+	}
+
+	return terms
+}
+
+// sameFunc checks if the two functions are the same top level function.
+func sameFunc(a, b interface{}) bool {
+	return reflect.ValueOf(a).Pointer() == reflect.ValueOf(b).Pointer()
+}
@@ -0,0 +1,299 @@
+package slide
+
+import (
+	"math"
+	"sort"
+
+	"github.com/paulmach/go.geo"
+)
+
+// untangleAttempts is how many times the corrections of crossing segments are damped.
+// The last attempt moves the vertices back to their previous location.
+const untangleAttempts = 3
+
+// untangle damps the corrections of the vertices of segments that cross each other
+// but did not cross in the previous path. If they still cross after a few attempts
+// the vertices are moved back to their previous location, rejecting the correction.
+// The paths must have the same number of vertices, the fixed vertices are never moved.
+func untangle(path, previous *geo.Path, fixed []bool) {
+	before := make(map[[2]int]bool)
+	for _, pair := range crossings(previous) {
+		before[pair] = true
+	}
+
+	for attempt := 1; attempt <= untangleAttempts; attempt++ {
+		found := false
+		for _, pair := range crossings(path) {
+			if before[pair] {
+				continue
+			}
+			found = true
+
+			for _, v := range []int{pair[0], pair[0] + 1, pair[1], pair[1] + 1} {
+				if fixed[v] {
+					continue
+				}
+
+				point := path.GetAt(v)
+				if attempt == untangleAttempts {
+					*point = *previous.GetAt(v)
+				} else {
+					point.Add(previous.GetAt(v)).Scale(0.5)
+				}
+			}
+		}
+
+		if !found {
+			return
+		}
+	}
+}
+
+// removeLoops cuts out the loops of the path where it crosses itself,
+// the vertices of a loop are replaced with the crossing point. The endpoints are kept.
+// Splits are indexes of vertices where the path continues into another segment,
+// loops around a fixed split are kept. The splits are updated to the new indexes,
+// a split that is cut out moves to the crossing point.
+func removeLoops(path *geo.Path, splits []int, fixed []bool) *geo.Path {
+	for {
+		// the first loop along the path, cutting it may remove the others
+		pairs := crossings(path)
+		first := -1
+		for k, pair := range pairs {
+			if aroundFixed(pair, splits, fixed) {
+				continue
+			}
+
+			if first < 0 || pair[0] < pairs[first][0] || (pair[0] == pairs[first][0] && pair[1] > pairs[first][1]) {
+				first = k
+			}
+		}
+
+		if first < 0 {
+			return path
+		}
+
+		i, j := pairs[first][0], pairs[first][1]
+		cross := intersection(path.GetAt(i), path.GetAt(i+1), path.GetAt(j), path.GetAt(j+1))
+
+		result := geo.NewPathPreallocate(0, path.Length()-(j-i)+1)
+		for k := 0; k <= i; k++ {
+			result.Push(path.GetAt(k))
+		}
+		result.Push(cross)
+		for k := j + 1; k < path.Length(); k++ {
+			result.Push(path.GetAt(k))
+		}
+
+		for k, split := range splits {
+			if split > j {
+				splits[k] = split - (j - i) + 1
+			} else if split > i {
+				splits[k] = i + 1
+			}
+		}
+
+		path = result
+	}
+}
+
+// aroundFixed checks if the loop of the crossing pair, vertices pair[0]+1 to pair[1], has a fixed split.
+func aroundFixed(pair [2]int, splits []int, fixed []bool) bool {
+	for k, split := range splits {
+		if fixed[k] && split > pair[0] && split <= pair[1] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// untangle runs untangle on every input path, the new paths of its segments joined together,
+// so folds across segments are found too. The segment ends, which are moved by the junction
+// corrections, and the segments that have converged, with a nil new path, are not moved.
+func (net *network) untangle(paths, previous []*geo.Path) {
+	for first := 0; first < len(net.Segments); first = net.lastSegment(first) + 1 {
+		last := net.lastSegment(first)
+
+		joined, before := geo.NewPath(), geo.NewPath()
+		var fixed []bool
+		for i := first; i <= last; i++ {
+			current := paths[i]
+			if current == nil {
+				current = previous[i]
+			}
+
+			for j := 0; j < current.Length(); j++ {
+				if j == 0 && i != first {
+					continue // same as the last vertex of the previous segment
+				}
+
+				joined.Push(current.GetAt(j))
+				before.Push(previous[i].GetAt(j))
+				fixed = append(fixed, paths[i] == nil || j == 0 || j == current.Length()-1)
+			}
+		}
+
+		untangle(joined, before, fixed)
+
+		v := 0
+		for i := first; i <= last; i++ {
+			for j := 0; j < previous[i].Length(); j++ {
+				if j == 0 && i != first {
+					continue
+				}
+
+				if !fixed[v] {
+					*paths[i].GetAt(j) = *joined.GetAt(v)
+				}
+				v++
+			}
+		}
+	}
+}
+
+// removeLoops runs removeLoops on every input path, its segment paths joined together,
+// and splits the result back into segments. Loops around a junction or a constrained
+// vertex are kept, only the artificial splits in the middle of rings can be cut out.
+func (net *network) removeLoops(paths []*geo.Path) []*geo.Path {
+	result := make([]*geo.Path, len(paths))
+	for first := 0; first < len(net.Segments); first = net.lastSegment(first) + 1 {
+		last := net.lastSegment(first)
+
+		joined := paths[first].Clone()
+		var (
+			splits []int
+			fixed  []bool
+		)
+		for i := first + 1; i <= last; i++ {
+			splits = append(splits, joined.Length()-1)
+			fixed = append(fixed, !net.ringSplit(i))
+
+			for j := 1; j < paths[i].Length(); j++ {
+				joined.Push(paths[i].GetAt(j))
+			}
+		}
+
+		joined = removeLoops(joined, splits, fixed)
+
+		start := 0
+		for i := first; i <= last; i++ {
+			end := joined.Length() - 1
+			if k := i - first; k < len(splits) {
+				end = splits[k]
+			}
+
+			result[i] = geo.NewPathPreallocate(0, end-start+1)
+			for j := start; j <= end; j++ {
+				result[i].Push(joined.GetAt(j))
+			}
+			start = end
+		}
+	}
+
+	return result
+}
+
+// lastSegment returns the last segment of the input path of the first segment,
+// the segments of an input path are next to each other and in order.
+func (net *network) lastSegment(first int) int {
+	last := first
+	for last+1 < len(net.Segments) && net.Segments[last+1].Path == net.Segments[first].Path {
+		last++
+	}
+
+	return last
+}
+
+// ringSplit checks if the segment starts at an artificial split in the middle of a ring,
+// not at a junction or constrained vertex.
+func (net *network) ringSplit(segment int) bool {
+	for _, junction := range net.Junctions {
+		for _, end := range junction.Ends {
+			if end.Segment == segment && end.First {
+				return len(junction.Vertices) == 1 && math.IsInf(junction.Radius, 1)
+			}
+		}
+	}
+
+	return false
+}
+
+// crossings returns the pairs of segments, by index of their first vertex, that cross.
+// Segments next to each other and segments that only touch do not cross.
+// The segments are sorted by x so only those with overlapping extents are compared.
+func crossings(path *geo.Path) [][2]int {
+	n := path.Length() - 1
+	if n < 3 {
+		return nil
+	}
+
+	order := &segmentsByX{path: path, indexes: make([]int, n)}
+	for i := range order.indexes {
+		order.indexes[i] = i
+	}
+	sort.Sort(order)
+
+	var pairs [][2]int
+	for a := 0; a < n; a++ {
+		i := order.indexes[a]
+		end := math.Max(path.GetAt(i).X(), path.GetAt(i+1).X())
+
+		for b := a + 1; b < n && order.minX(b) <= end; b++ {
+			j := order.indexes[b]
+			if i-j <= 1 && j-i <= 1 {
+				continue // adjacent segments share a vertex
+			}
+
+			if segmentsCross(path.GetAt(i), path.GetAt(i+1), path.GetAt(j), path.GetAt(j+1)) {
+				if i < j {
+					pairs = append(pairs, [2]int{i, j})
+				} else {
+					pairs = append(pairs, [2]int{j, i})
+				}
+			}
+		}
+	}
+
+	return pairs
+}
+
+// segmentsCross checks if the segment ab properly crosses the segment cd.
+func segmentsCross(a, b, c, d *geo.Point) bool {
+	d1 := orientation(c, d, a)
+	d2 := orientation(c, d, b)
+	d3 := orientation(a, b, c)
+	d4 := orientation(a, b, d)
+
+	return d1*d2 < 0 && d3*d4 < 0
+}
+
+// orientation is the cross product of ab and ac, positive if c is to the left of ab.
+func orientation(a, b, c *geo.Point) float64 {
+	return (b.X()-a.X())*(c.Y()-a.Y()) - (b.Y()-a.Y())*(c.X()-a.X())
+}
+
+// intersection returns the point where the line through ab crosses the line through cd.
+func intersection(a, b, c, d *geo.Point) *geo.Point {
+	ab := b.Clone().Subtract(a)
+	cd := d.Clone().Subtract(c)
+	ac := c.Clone().Subtract(a)
+
+	t := (ac.X()*cd.Y() - ac.Y()*cd.X()) / (ab.X()*cd.Y() - ab.Y()*cd.X())
+	return ab.Scale(t).Add(a)
+}
+
+// segmentsByX sorts the segments of the path by their minimum x.
+type segmentsByX struct {
+	path    *geo.Path
+	indexes []int
+}
+
+func (s *segmentsByX) minX(k int) float64 {
+	i := s.indexes[k]
+	return math.Min(s.path.GetAt(i).X(), s.path.GetAt(i+1).X())
+}
+
+func (s *segmentsByX) Len() int           { return len(s.indexes) }
+func (s *segmentsByX) Less(a, b int) bool { return s.minX(a) < s.minX(b) }
+func (s *segmentsByX) Swap(a, b int)      { s.indexes[a], s.indexes[b] = s.indexes[b], s.indexes[a] }
@@ -0,0 +1,105 @@
+package slide
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/paulmach/go.geo"
+)
+
+func testPath(points ...[2]float64) *geo.Path {
+	p := geo.NewPath()
+	for _, point := range points {
+		p.Push(geo.NewPoint(point[0], point[1]))
+	}
+
+	return p
+}
+
+// twoSegments is an input path split in two at its vertex 3.
+func twoSegments(radius float64) *network {
+	return &network{
+		Geometry: make([]*geo.Path, 1),
+		Segments: []segment{{Path: 0, Start: 0, End: 3}, {Path: 0, Start: 3, End: 6}},
+		Junctions: []*junctionState{{
+			Vertices: []VertexRef{{Path: 0, Index: 3}},
+			Ends:     []segmentEnd{{Segment: 0, First: false}, {Segment: 1, First: true}},
+			Radius:   radius,
+		}},
+	}
+}
+
+func joinedCrossings(net *network, paths []*geo.Path) [][2]int {
+	return crossings(net.join(paths)[0])
+}
+
+func TestNetworkUntangle(t *testing.T) {
+	net := twoSegments(math.Inf(1))
+
+	previous := []*geo.Path{
+		testPath([2]float64{0, 0}, [2]float64{2, 0}, [2]float64{4, 0}, [2]float64{4, 2}),
+		testPath([2]float64{4, 2}, [2]float64{3, 2}, [2]float64{2, 2}, [2]float64{1, 2}),
+	}
+
+	// the second segment folds back over the first.
+	paths := []*geo.Path{previous[0].Clone(), previous[1].Clone()}
+	paths[1].SetAt(2, geo.NewPoint(2, -1))
+
+	if len(crossings(paths[0])) != 0 || len(crossings(paths[1])) != 0 {
+		t.Fatalf("expected no crossings within the segments")
+	}
+
+	net.untangle(paths, previous)
+
+	if c := joinedCrossings(net, paths); len(c) != 0 {
+		t.Errorf("expected no crossings across the segments, got %v", c)
+	}
+
+	if p := paths[1].GetAt(0); !p.Equals(previous[1].GetAt(0)) {
+		t.Errorf("segment end moved to %v", p)
+	}
+
+	// a converged segment is not moved, only the other one.
+	paths = []*geo.Path{previous[0].Clone(), nil}
+	paths[0].SetAt(1, geo.NewPoint(2, 3))
+
+	net.untangle(paths, previous)
+
+	if c := joinedCrossings(net, []*geo.Path{paths[0], previous[1]}); len(c) != 0 {
+		t.Errorf("expected no crossings with the converged segment, got %v", c)
+	}
+}
+
+func TestNetworkRemoveLoops(t *testing.T) {
+	// the loop is around the end of the first segment.
+	paths := func() []*geo.Path {
+		return []*geo.Path{
+			testPath([2]float64{0, 0}, [2]float64{2, 0}, [2]float64{4, 0}, [2]float64{3, 2}),
+			testPath([2]float64{3, 2}, [2]float64{2, -2}, [2]float64{1, -3}, [2]float64{0, -4}),
+		}
+	}
+
+	// an artificial ring split is cut out with the loop.
+	result := twoSegments(math.Inf(1)).removeLoops(paths())
+
+	expected := []*geo.Path{
+		testPath([2]float64{0, 0}, [2]float64{2, 0}, [2]float64{2.5, 0}),
+		testPath([2]float64{2.5, 0}, [2]float64{2, -2}, [2]float64{1, -3}, [2]float64{0, -4}),
+	}
+
+	for i := range expected {
+		if !reflect.DeepEqual(result[i].Points(), expected[i].Points()) {
+			t.Errorf("segment %d: expected %v, got %v", i, expected[i].Points(), result[i].Points())
+		}
+	}
+
+	// the loop around a constrained vertex is kept.
+	result = twoSegments(0).removeLoops(paths())
+
+	for i, p := range paths() {
+		if !reflect.DeepEqual(result[i].Points(), p.Points()) {
+			t.Errorf("constrained segment %d: expected %v, got %v", i, p.Points(), result[i].Points())
+		}
+	}
+}